@@ -0,0 +1,112 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/SchoIsles/kruise-state-metrics/pkg/options"
+)
+
+// clusterConfig is the client config of a watched cluster. The name is empty
+// in single-cluster mode.
+type clusterConfig struct {
+	name   string
+	config *rest.Config
+}
+
+// isMultiCluster returns whether more than the single cluster of the
+// kubeconfig or in-cluster config is watched, each labeled with its name.
+func isMultiCluster(opts *options.Options) bool {
+	return len(opts.KubeconfigContexts) > 0 || opts.KubeconfigDir != ""
+}
+
+// loadClusterConfigs returns the configs of the clusters to watch: one per
+// --kubeconfig-contexts context or --kubeconfig-dir file, or the single
+// cluster of --apiserver and --kubeconfig.
+func loadClusterConfigs(opts *options.Options) ([]clusterConfig, error) {
+	if len(opts.KubeconfigContexts) > 0 && opts.KubeconfigDir != "" {
+		return nil, errors.New("--kubeconfig-contexts and --kubeconfig-dir are mutually exclusive")
+	}
+
+	if len(opts.KubeconfigContexts) > 0 {
+		configs := []clusterConfig{}
+		seen := map[string]struct{}{}
+		for _, context := range opts.KubeconfigContexts {
+			if _, ok := seen[context]; ok {
+				return nil, errors.Errorf("context %s is given more than once", context)
+			}
+			seen[context] = struct{}{}
+			config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+				&clientcmd.ClientConfigLoadingRules{ExplicitPath: opts.Kubeconfig},
+				&clientcmd.ConfigOverrides{CurrentContext: context},
+			).ClientConfig()
+			if err != nil {
+				return nil, errors.Wrapf(err, "context %s", context)
+			}
+			configs = append(configs, clusterConfig{name: context, config: config})
+		}
+		return configs, nil
+	}
+
+	if opts.KubeconfigDir != "" {
+		files, err := ioutil.ReadDir(opts.KubeconfigDir)
+		if err != nil {
+			return nil, err
+		}
+
+		configs := []clusterConfig{}
+		seen := map[string]string{}
+		for _, f := range files {
+			if f.IsDir() || strings.HasPrefix(f.Name(), ".") {
+				continue
+			}
+			name := strings.TrimSuffix(f.Name(), filepath.Ext(f.Name()))
+			if other, ok := seen[name]; ok {
+				return nil, errors.Errorf("kubeconfigs %s and %s have the same cluster name %s", other, f.Name(), name)
+			}
+			seen[name] = f.Name()
+			config, err := clientcmd.BuildConfigFromFlags("", filepath.Join(opts.KubeconfigDir, f.Name()))
+			if err != nil {
+				return nil, errors.Wrapf(err, "kubeconfig %s", f.Name())
+			}
+			configs = append(configs, clusterConfig{name: name, config: config})
+		}
+		if len(configs) == 0 {
+			return nil, errors.Errorf("no kubeconfig found in %s", opts.KubeconfigDir)
+		}
+		return configs, nil
+	}
+
+	config, err := clientcmd.BuildConfigFromFlags(opts.Apiserver, opts.Kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	return []clusterConfig{{config: config}}, nil
+}
+
+// clusterGatherer adds the cluster label to every metric gathered from the
+// self metrics registry of a cluster.
+type clusterGatherer struct {
+	cluster  string
+	gatherer prometheus.Gatherer
+}
+
+func (g clusterGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := g.gatherer.Gather()
+	for _, mf := range families {
+		for _, m := range mf.Metric {
+			name, value := "cluster", g.cluster
+			m.Label = append(m.Label, &dto.LabelPair{Name: &name, Value: &value})
+			sort.Slice(m.Label, func(i, j int) bool { return m.Label[i].GetName() < m.Label[j].GetName() })
+		}
+	}
+	return families, err
+}
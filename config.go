@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/klog"
+	ksmoptions "k8s.io/kube-state-metrics/pkg/options"
+	"k8s.io/kube-state-metrics/pkg/whiteblacklist"
+
+	"github.com/SchoIsles/kruise-state-metrics/internal/store"
+	"github.com/SchoIsles/kruise-state-metrics/pkg/metricshandler"
+	"github.com/SchoIsles/kruise-state-metrics/pkg/options"
+)
+
+// newBuilderConfigurer validates the collector, custom resource, namespace,
+// metric and allow list options and returns a function applying them to a store
+// builder.
+func newBuilderConfigurer(opts *options.Options) (func(b *store.Builder) error, error) {
+	collectors := options.DefaultCollectors
+	if len(opts.Collectors) != 0 {
+		collectors = opts.Collectors
+	}
+	for _, set := range []ksmoptions.CollectorSet{collectors, opts.CollectorsDenylist, opts.ForceCollectors} {
+		for c := range set {
+			if !store.CollectorExists(c) {
+				return nil, errors.Errorf("collector %s does not exist. Available collectors: %s", c, strings.Join(store.AvailableCollectors(), ","))
+			}
+		}
+	}
+
+	namespaces := opts.Namespaces
+	if len(namespaces) == 0 {
+		klog.Info("Using all namespace")
+		namespaces = ksmoptions.DefaultNamespaces
+	} else if namespaces.IsAllNamespaces() {
+		klog.Info("Using all namespace")
+	} else {
+		klog.Infof("Using %s namespaces", namespaces)
+	}
+
+	whiteBlackList, err := whiteblacklist.New(opts.MetricWhitelist, opts.MetricBlacklist)
+	if err != nil {
+		return nil, err
+	}
+	if err := whiteBlackList.Parse(); err != nil {
+		return nil, errors.Wrap(err, "error initializing the whiteblack list")
+	}
+
+	labelsAllowList := opts.LabelsAllowList
+	if len(labelsAllowList) == 0 {
+		labelsAllowList = options.DefaultLabelsAllowList
+	}
+
+	// In multi-cluster mode every sample gets a cluster label, which the
+	// custom resources must not use.
+	var reservedLabels []string
+	if isMultiCluster(opts) {
+		reservedLabels = []string{store.ClusterLabel}
+	}
+	customCollectors, err := store.ValidateCustomResources(opts.CustomResources, reservedLabels...)
+	if err != nil {
+		return nil, err
+	}
+
+	for flag, lists := range map[string]options.LabelsAllowList{
+		"metric-labels-allowlist":      opts.LabelsAllowList,
+		"metric-annotations-allowlist": opts.AnnotationsAllowList,
+	} {
+		if err := validateAllowListResources(lists, customCollectors); err != nil {
+			return nil, errors.Wrap(err, flag)
+		}
+	}
+
+	return func(b *store.Builder) error {
+		if err := b.WithEnabledResources(collectors.AsSlice()); err != nil {
+			return err
+		}
+		if err := b.WithDisabledResources(opts.CollectorsDenylist.AsSlice()); err != nil {
+			return err
+		}
+		if err := b.WithForceEnabledResources(opts.ForceCollectors.AsSlice()); err != nil {
+			return err
+		}
+		if err := b.WithCustomResources(opts.CustomResources); err != nil {
+			return err
+		}
+
+		b.WithNamespaces(namespaces)
+		b.WithWhiteBlackList(whiteBlackList)
+		b.WithAllowLabels(labelsAllowList)
+		b.WithAllowAnnotations(opts.AnnotationsAllowList)
+		return nil
+	}, nil
+}
+
+// validateAllowListResources returns an error if a resource of the given allow
+// lists is neither the wildcard nor a built-in or custom resource collector.
+func validateAllowListResources(lists options.LabelsAllowList, customCollectors []string) error {
+	for resource := range lists {
+		if resource == options.LabelWildcard || store.CollectorExists(resource) || containsString(customCollectors, resource) {
+			continue
+		}
+		return errors.Errorf("collector %s does not exist", resource)
+	}
+	return nil
+}
+
+// configMetrics are the self metrics reporting the state of the config file.
+type configMetrics struct {
+	hash                 prometheus.Gauge
+	lastReloadSuccessful prometheus.Gauge
+	lastReloadSuccess    prometheus.Gauge
+}
+
+func newConfigMetrics(r prometheus.Registerer) *configMetrics {
+	m := &configMetrics{
+		hash: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "kruise_state_metrics_config_hash",
+			Help: "Hash of the currently loaded config file.",
+		}),
+		lastReloadSuccessful: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "kruise_state_metrics_config_last_reload_successful",
+			Help: "Whether the last attempt to load the config file was successful.",
+		}),
+		lastReloadSuccess: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "kruise_state_metrics_config_last_reload_success_timestamp_seconds",
+			Help: "Unix timestamp of the last successful load of the config file.",
+		}),
+	}
+	r.MustRegister(m.hash, m.lastReloadSuccessful, m.lastReloadSuccess)
+	return m
+}
+
+func (m *configMetrics) success(hash string) {
+	m.hash.Set(hashAsMetricValue(hash))
+	m.lastReloadSuccessful.Set(1)
+	m.lastReloadSuccess.SetToCurrentTime()
+}
+
+func (m *configMetrics) failure() {
+	m.lastReloadSuccessful.Set(0)
+}
+
+// hashAsMetricValue returns the first 48 bits of the hex encoded hash, which
+// a float64 represents exactly.
+func hashAsMetricValue(hash string) float64 {
+	v, err := strconv.ParseUint(hash[:12], 16, 64)
+	if err != nil {
+		return 0
+	}
+	return float64(v)
+}
+
+// loadConfig returns flagOpts overridden by the config file at path, along
+// with the hash of the file.
+func loadConfig(path string, flagOpts *options.Options) (*options.Options, string, error) {
+	config, hash, err := options.LoadConfig(path)
+	if err != nil {
+		return nil, "", err
+	}
+	return config.Apply(flagOpts), hash, nil
+}
+
+// watchConfig checks the config file at path for changes every interval and
+// applies them to the stores of m. Settings removed from the file fall back
+// to flagOpts.
+func watchConfig(ctx context.Context, m *metricshandler.MetricsHandler, metrics *configMetrics, path string, interval time.Duration, flagOpts *options.Options, hash string) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		opts, newHash, err := loadConfig(path, flagOpts)
+		if err != nil {
+			klog.Errorf("Failed to load config file %s: %v", path, err)
+			metrics.failure()
+			continue
+		}
+		if newHash == hash {
+			metrics.lastReloadSuccessful.Set(1)
+			continue
+		}
+
+		configure, err := newBuilderConfigurer(opts)
+		if err != nil {
+			klog.Errorf("Invalid config file %s: %v", path, err)
+			metrics.failure()
+			continue
+		}
+		if err := m.Reconfigure(ctx, configure, opts.Shard, opts.TotalShards); err != nil {
+			klog.Errorf("Failed to apply config file %s: %v", path, err)
+			metrics.failure()
+			continue
+		}
+
+		klog.Infof("Reloaded config file %s", path)
+		hash = newHash
+		metrics.success(hash)
+	}
+}
@@ -4,9 +4,13 @@ go 1.14
 
 require (
 	github.com/evanphx/json-patch v4.9.0+incompatible // indirect
+	github.com/klauspost/compress v1.11.3
 	github.com/openkruise/kruise-api v0.6.0
 	github.com/pkg/errors v0.9.1
 	github.com/prometheus/client_golang v1.1.0
+	github.com/prometheus/client_model v0.0.0-20190812154241-14fe0d1b01d4
+	github.com/prometheus/common v0.6.0
+	github.com/spf13/pflag v1.0.5
 	golang.org/x/oauth2 v0.0.0-20201109201403-9fd604954f58 // indirect
 	golang.org/x/time v0.0.0-20200630173020-3af7569d3a1e // indirect
 	k8s.io/api v0.0.0-20191112020540-7f9008e52f64
@@ -16,4 +20,5 @@ require (
 	k8s.io/klog v1.0.0
 	k8s.io/kube-state-metrics v1.9.7
 	k8s.io/utils v0.0.0-20201110183641-67b214c5f920 // indirect
+	sigs.k8s.io/yaml v1.1.0
 )
@@ -0,0 +1,346 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"k8s.io/kube-state-metrics/pkg/metric"
+
+	clientset "github.com/SchoIsles/kruise-state-metrics/pkg/client/clientset/versioned"
+	kruiseappsv1alpha1 "github.com/openkruise/kruise-api/apps/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+var (
+	descBroadcastJobAnnotationsName     = "kube_broadcastjob_annotations"
+	descBroadcastJobAnnotationsHelp     = "Kubernetes annotations converted to Prometheus labels."
+	descBroadcastJobLabelsName          = "kube_broadcastjob_labels"
+	descBroadcastJobLabelsHelp          = "Kubernetes labels converted to Prometheus labels."
+	descBroadcastJobLabelsDefaultLabels = []string{"namespace", "broadcastjob"}
+
+	broadcastJobPhases = []kruiseappsv1alpha1.BroadcastJobPhase{
+		kruiseappsv1alpha1.PhaseRunning,
+		kruiseappsv1alpha1.PhasePaused,
+		kruiseappsv1alpha1.PhaseCompleted,
+		kruiseappsv1alpha1.PhaseFailed,
+	}
+)
+
+func broadcastJobMetricFamilies(allowAnnotationsList, allowLabelsList []string) []metric.FamilyGenerator {
+	return []metric.FamilyGenerator{
+		{
+			Name: "kube_broadcastjob_created",
+			Type: metric.Gauge,
+			Help: "Unix creation timestamp",
+			GenerateFunc: wrapBroadcastJobFunc(func(j *kruiseappsv1alpha1.BroadcastJob) *metric.Family {
+				ms := []*metric.Metric{}
+
+				if !j.CreationTimestamp.IsZero() {
+					ms = append(ms, &metric.Metric{
+						Value: float64(j.CreationTimestamp.Unix()),
+					})
+				}
+
+				return &metric.Family{
+					Metrics: ms,
+				}
+			}),
+		},
+		{
+			Name: "kube_broadcastjob_status_desired",
+			Type: metric.Gauge,
+			Help: "The number of nodes the broadcastjob should run on.",
+			GenerateFunc: wrapBroadcastJobFunc(func(j *kruiseappsv1alpha1.BroadcastJob) *metric.Family {
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							Value: float64(j.Status.Desired),
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: "kube_broadcastjob_status_active",
+			Type: metric.Gauge,
+			Help: "The number of actively running pods.",
+			GenerateFunc: wrapBroadcastJobFunc(func(j *kruiseappsv1alpha1.BroadcastJob) *metric.Family {
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							Value: float64(j.Status.Active),
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: "kube_broadcastjob_status_succeeded",
+			Type: metric.Gauge,
+			Help: "The number of pods which reached phase Succeeded.",
+			GenerateFunc: wrapBroadcastJobFunc(func(j *kruiseappsv1alpha1.BroadcastJob) *metric.Family {
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							Value: float64(j.Status.Succeeded),
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: "kube_broadcastjob_status_failed",
+			Type: metric.Gauge,
+			Help: "The number of pods which reached phase Failed.",
+			GenerateFunc: wrapBroadcastJobFunc(func(j *kruiseappsv1alpha1.BroadcastJob) *metric.Family {
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							Value: float64(j.Status.Failed),
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: "kube_broadcastjob_status_phase",
+			Type: metric.Gauge,
+			Help: "The current phase of the broadcastjob.",
+			GenerateFunc: wrapBroadcastJobFunc(func(j *kruiseappsv1alpha1.BroadcastJob) *metric.Family {
+				ms := make([]*metric.Metric, len(broadcastJobPhases))
+
+				for i, p := range broadcastJobPhases {
+					ms[i] = &metric.Metric{
+						LabelKeys:   []string{"phase"},
+						LabelValues: []string{string(p)},
+						Value:       boolFloat64(j.Status.Phase == p),
+					}
+				}
+
+				return &metric.Family{
+					Metrics: ms,
+				}
+			}),
+		},
+		{
+			Name: "kube_broadcastjob_status_start_time",
+			Type: metric.Gauge,
+			Help: "StartTime represents time when the broadcastjob was acknowledged by the broadcastjob controller.",
+			GenerateFunc: wrapBroadcastJobFunc(func(j *kruiseappsv1alpha1.BroadcastJob) *metric.Family {
+				ms := []*metric.Metric{}
+
+				if j.Status.StartTime != nil {
+					ms = append(ms, &metric.Metric{
+						Value: float64(j.Status.StartTime.Unix()),
+					})
+				}
+
+				return &metric.Family{
+					Metrics: ms,
+				}
+			}),
+		},
+		{
+			Name: "kube_broadcastjob_status_completion_time",
+			Type: metric.Gauge,
+			Help: "CompletionTime represents time when the broadcastjob was completed.",
+			GenerateFunc: wrapBroadcastJobFunc(func(j *kruiseappsv1alpha1.BroadcastJob) *metric.Family {
+				ms := []*metric.Metric{}
+
+				if j.Status.CompletionTime != nil {
+					ms = append(ms, &metric.Metric{
+						Value: float64(j.Status.CompletionTime.Unix()),
+					})
+				}
+
+				return &metric.Family{
+					Metrics: ms,
+				}
+			}),
+		},
+		{
+			Name: "kube_broadcastjob_duration_seconds",
+			Type: metric.Gauge,
+			Help: "The time in seconds a finished broadcastjob took from start to completion.",
+			GenerateFunc: wrapBroadcastJobFunc(func(j *kruiseappsv1alpha1.BroadcastJob) *metric.Family {
+				ms := []*metric.Metric{}
+
+				if j.Status.StartTime != nil && j.Status.CompletionTime != nil {
+					ms = append(ms, &metric.Metric{
+						Value: j.Status.CompletionTime.Sub(j.Status.StartTime.Time).Seconds(),
+					})
+				}
+
+				return &metric.Family{
+					Metrics: ms,
+				}
+			}),
+		},
+		{
+			Name: "kube_broadcastjob_spec_parallelism",
+			Type: metric.Gauge,
+			Help: "The maximum desired number of pods the broadcastjob should run at any given time.",
+			GenerateFunc: wrapBroadcastJobFunc(func(j *kruiseappsv1alpha1.BroadcastJob) *metric.Family {
+				if j.Spec.Parallelism == nil {
+					return &metric.Family{}
+				}
+
+				parallelism, err := intstr.GetValueFromIntOrPercent(j.Spec.Parallelism, int(j.Status.Desired), true)
+				if err != nil {
+					return generateError("kube_broadcastjob_spec_parallelism", j, err)
+				}
+
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							Value: float64(parallelism),
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: "kube_broadcastjob_spec_completion_policy",
+			Type: metric.Gauge,
+			Help: "The completion policy type of the broadcastjob.",
+			GenerateFunc: wrapBroadcastJobFunc(func(j *kruiseappsv1alpha1.BroadcastJob) *metric.Family {
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							LabelKeys:   []string{"type"},
+							LabelValues: []string{string(j.Spec.CompletionPolicy.Type)},
+							Value:       1,
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: "kube_broadcastjob_spec_active_deadline_seconds",
+			Type: metric.Gauge,
+			Help: "The duration in seconds relative to the startTime that the broadcastjob may be active before the system tries to terminate it.",
+			GenerateFunc: wrapBroadcastJobFunc(func(j *kruiseappsv1alpha1.BroadcastJob) *metric.Family {
+				ms := []*metric.Metric{}
+
+				if j.Spec.CompletionPolicy.ActiveDeadlineSeconds != nil {
+					ms = append(ms, &metric.Metric{
+						Value: float64(*j.Spec.CompletionPolicy.ActiveDeadlineSeconds),
+					})
+				}
+
+				return &metric.Family{
+					Metrics: ms,
+				}
+			}),
+		},
+		{
+			Name: "kube_broadcastjob_spec_ttl_seconds_after_finished",
+			Type: metric.Gauge,
+			Help: "The number of seconds after which a finished broadcastjob is eligible to be deleted.",
+			GenerateFunc: wrapBroadcastJobFunc(func(j *kruiseappsv1alpha1.BroadcastJob) *metric.Family {
+				ms := []*metric.Metric{}
+
+				if j.Spec.CompletionPolicy.TTLSecondsAfterFinished != nil {
+					ms = append(ms, &metric.Metric{
+						Value: float64(*j.Spec.CompletionPolicy.TTLSecondsAfterFinished),
+					})
+				}
+
+				return &metric.Family{
+					Metrics: ms,
+				}
+			}),
+		},
+		{
+			Name: "kube_broadcastjob_spec_paused",
+			Type: metric.Gauge,
+			Help: "Whether the broadcastjob is paused.",
+			GenerateFunc: wrapBroadcastJobFunc(func(j *kruiseappsv1alpha1.BroadcastJob) *metric.Family {
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							Value: boolFloat64(j.Spec.Paused),
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: descBroadcastJobAnnotationsName,
+			Type: metric.Gauge,
+			Help: descBroadcastJobAnnotationsHelp,
+			GenerateFunc: wrapBroadcastJobFunc(func(j *kruiseappsv1alpha1.BroadcastJob) *metric.Family {
+				annotationKeys, annotationValues := createPrometheusLabelKeysValues("annotation", j.Annotations, allowAnnotationsList)
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							LabelKeys:   annotationKeys,
+							LabelValues: annotationValues,
+							Value:       1,
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: descBroadcastJobLabelsName,
+			Type: metric.Gauge,
+			Help: descBroadcastJobLabelsHelp,
+			GenerateFunc: wrapBroadcastJobFunc(func(j *kruiseappsv1alpha1.BroadcastJob) *metric.Family {
+				labelKeys, labelValues := createPrometheusLabelKeysValues("label", j.Labels, allowLabelsList)
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							LabelKeys:   labelKeys,
+							LabelValues: labelValues,
+							Value:       1,
+						},
+					},
+				}
+			}),
+		},
+	}
+}
+
+func wrapBroadcastJobFunc(f func(*kruiseappsv1alpha1.BroadcastJob) *metric.Family) func(interface{}) *metric.Family {
+	return func(obj interface{}) *metric.Family {
+		broadcastJob := obj.(*kruiseappsv1alpha1.BroadcastJob)
+
+		metricFamily := f(broadcastJob)
+
+		for _, m := range metricFamily.Metrics {
+			m.LabelKeys = append(descBroadcastJobLabelsDefaultLabels, m.LabelKeys...)
+			m.LabelValues = append([]string{broadcastJob.Namespace, broadcastJob.Name}, m.LabelValues...)
+		}
+
+		return metricFamily
+	}
+}
+
+func createBroadcastJobListWatch(kubeClient clientset.Interface, ns string) cache.ListerWatcher {
+	return &cache.ListWatch{
+		ListFunc: func(opts metav1.ListOptions) (runtime.Object, error) {
+			return kubeClient.AppsV1alpha1().BroadcastJobs(ns).List(opts)
+		},
+		WatchFunc: func(opts metav1.ListOptions) (watch.Interface, error) {
+			return kubeClient.AppsV1alpha1().BroadcastJobs(ns).Watch(opts)
+		},
+	}
+}
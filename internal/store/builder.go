@@ -18,22 +18,32 @@ package store
 
 import (
 	"context"
+	"io"
 	"reflect"
 	"sort"
 	"strings"
+	"sync"
 
 	clientset "github.com/SchoIsles/kruise-state-metrics/pkg/client/clientset/versioned"
+	"github.com/SchoIsles/kruise-state-metrics/pkg/options"
 	kruiseappsv1alpha1 "github.com/openkruise/kruise-api/apps/v1alpha1"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	vpaclientset "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/client/clientset/versioned"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/klog"
 
 	"k8s.io/kube-state-metrics/pkg/listwatch"
 	"k8s.io/kube-state-metrics/pkg/metric"
 	metricsstore "k8s.io/kube-state-metrics/pkg/metrics_store"
-	"k8s.io/kube-state-metrics/pkg/options"
+	ksmoptions "k8s.io/kube-state-metrics/pkg/options"
 	"k8s.io/kube-state-metrics/pkg/sharding"
 	"k8s.io/kube-state-metrics/pkg/watch"
 )
@@ -46,30 +56,70 @@ type whiteBlackLister interface {
 // Builder helps to build store. It follows the builder pattern
 // (https://en.wikipedia.org/wiki/Builder_pattern).
 type Builder struct {
+	cluster          string
 	kubeClient       clientset.Interface
+	coreClient       kubernetes.Interface
+	dynamicClient    dynamic.Interface
 	vpaClient        vpaclientset.Interface
-	namespaces       options.NamespaceList
+	namespaces       ksmoptions.NamespaceList
 	ctx              context.Context
 	enabledResources []string
 	whiteBlackList   whiteBlackLister
 	metrics          *watch.ListWatchMetrics
 	shard            int32
 	totalShards      int
+
+	syncTracker       *syncTracker
+	rolloutTracker    *rolloutTracker
+	transitionTracker *transitionTracker
+
+	allowAnnotationsList map[string][]string
+	allowLabelsList      map[string][]string
+
+	customResources []*customResource
+	// openMetricsFamilies are the OpenMetrics types of the custom resource
+	// families of the last Build.
+	openMetricsFamilies map[string]OpenMetricsFamily
+
+	forceEnabledResources map[string]struct{}
+	activeResources       []string
+	skippedCollectors     *prometheus.GaugeVec
+
+	// discoveryMtx protects discoveryErr, the result of the last API
+	// discovery, and discoveryClient and customResources, which Discover
+	// reads without the caller holding a lock.
+	discoveryMtx    sync.RWMutex
+	discoveryErr    error
+	discoveryClient discovery.DiscoveryInterface
 }
 
 // NewBuilder returns a new builder.
-func NewBuilder() *Builder { return &Builder{} }
+func NewBuilder() *Builder { return &Builder{rolloutTracker: newRolloutTracker()} }
 
 // WithMetrics sets the metrics property of a Builder.
 func (b *Builder) WithMetrics(r *prometheus.Registry) {
 	b.metrics = watch.NewListWatchMetrics(r)
+	b.skippedCollectors = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kruise_state_metrics_collector_skipped",
+			Help: "Whether an enabled collector was skipped because its resource is not served by the API server.",
+		},
+		[]string{"collector"},
+	)
+	r.MustRegister(b.skippedCollectors)
+}
+
+// RegisterMetrics registers the metrics shared by all builders of the process
+// with the given registerer. It must be called only once.
+func RegisterMetrics(r prometheus.Registerer) {
+	r.MustRegister(labelCollisionsTotal, generateErrorsTotal)
 }
 
 // WithEnabledResources sets the enabledResources property of a Builder.
 func (b *Builder) WithEnabledResources(c []string) error {
 	for _, col := range c {
-		if !collectorExists(col) {
-			return errors.Errorf("collector %s does not exist. Available collectors: %s", col, strings.Join(availableCollectors(), ","))
+		if !CollectorExists(col) {
+			return errors.Errorf("collector %s does not exist. Available collectors: %s", col, strings.Join(AvailableCollectors(), ","))
 		}
 	}
 
@@ -82,8 +132,69 @@ func (b *Builder) WithEnabledResources(c []string) error {
 	return nil
 }
 
+// WithDisabledResources removes the given collectors from the enabledResources
+// property of a Builder. It must be called after WithEnabledResources.
+func (b *Builder) WithDisabledResources(c []string) error {
+	disabled := map[string]struct{}{}
+	for _, col := range c {
+		if !CollectorExists(col) {
+			return errors.Errorf("collector %s does not exist. Available collectors: %s", col, strings.Join(AvailableCollectors(), ","))
+		}
+		disabled[col] = struct{}{}
+	}
+
+	enabled := []string{}
+	for _, col := range b.enabledResources {
+		if _, ok := disabled[col]; !ok {
+			enabled = append(enabled, col)
+		}
+	}
+
+	b.enabledResources = enabled
+	return nil
+}
+
+// WithForceEnabledResources sets collectors that are built even if API
+// discovery reports their resource as not served.
+func (b *Builder) WithForceEnabledResources(c []string) error {
+	forced := map[string]struct{}{}
+	for _, col := range c {
+		if !CollectorExists(col) {
+			return errors.Errorf("collector %s does not exist. Available collectors: %s", col, strings.Join(AvailableCollectors(), ","))
+		}
+		forced[col] = struct{}{}
+	}
+
+	b.forceEnabledResources = forced
+	return nil
+}
+
+// WithAllowAnnotations configures which Kubernetes annotations are exported
+// per resource by the annotations metric of each collector.
+func (b *Builder) WithAllowAnnotations(annotations map[string][]string) {
+	b.allowAnnotationsList = annotations
+}
+
+// WithAllowLabels configures which Kubernetes labels are exported per
+// resource by the labels metric of each collector.
+func (b *Builder) WithAllowLabels(labels map[string][]string) {
+	b.allowLabelsList = labels
+}
+
+// WithCluster sets the name of the cluster the Builder watches. It is
+// reported with every workload event and must be set before WithEventSink.
+func (b *Builder) WithCluster(name string) {
+	b.cluster = name
+}
+
+// WithEventSink enables reporting transitions of watched workloads, such as a
+// new update revision or a failing condition, to the given sink.
+func (b *Builder) WithEventSink(s EventSink) {
+	b.transitionTracker = newTransitionTracker(b.cluster, s)
+}
+
 // WithNamespaces sets the namespaces property of a Builder.
-func (b *Builder) WithNamespaces(n options.NamespaceList) {
+func (b *Builder) WithNamespaces(n ksmoptions.NamespaceList) {
 	b.namespaces = n
 }
 
@@ -103,6 +214,46 @@ func (b *Builder) WithKubeClient(c clientset.Interface) {
 	b.kubeClient = c
 }
 
+// WithCoreClient sets the coreClient property of a Builder so that
+// collectors of core resources such as pods can list and watch them.
+func (b *Builder) WithCoreClient(c kubernetes.Interface) {
+	b.coreClient = c
+}
+
+// WithDiscoveryClient sets the client API discovery is run with. It should
+// have a short timeout, as discovery blocks rebuilding the stores. Defaults
+// to the discovery client of the kubeClient.
+func (b *Builder) WithDiscoveryClient(c discovery.DiscoveryInterface) {
+	b.discoveryMtx.Lock()
+	defer b.discoveryMtx.Unlock()
+	b.discoveryClient = c
+}
+
+// WithDynamicClient sets the dynamicClient property of a Builder so that the
+// collectors of custom resources can list and watch them.
+func (b *Builder) WithDynamicClient(c dynamic.Interface) {
+	b.dynamicClient = c
+}
+
+// WithCustomResources configures a collector for each of the given custom
+// resources, in addition to the enabled collectors. If a cluster name is set,
+// the custom resources must not use the cluster label, so it must be set
+// before.
+func (b *Builder) WithCustomResources(specs []options.CustomResource) error {
+	var reservedLabels []string
+	if b.cluster != "" {
+		reservedLabels = []string{ClusterLabel}
+	}
+	crs, err := compileCustomResources(specs, reservedLabels...)
+	if err != nil {
+		return err
+	}
+	b.discoveryMtx.Lock()
+	defer b.discoveryMtx.Unlock()
+	b.customResources = crs
+	return nil
+}
+
 // WithVPAClient sets the vpaClient property of a Builder so that the verticalpodautoscaler collector can query VPA objects.
 func (b *Builder) WithVPAClient(c vpaclientset.Interface) {
 	b.vpaClient = c
@@ -114,8 +265,10 @@ func (b *Builder) WithWhiteBlackList(l whiteBlackLister) {
 	b.whiteBlackList = l
 }
 
-// Build initializes and registers all enabled stores.
-func (b *Builder) Build() []*metricsstore.MetricsStore {
+// Build initializes and registers all enabled stores whose resource is served
+// according to the given discovery. It returns the stores along with the
+// name of the collector of each store.
+func (b *Builder) Build(d *Discovery) ([]*metricsstore.MetricsStore, []string) {
 	if b.whiteBlackList == nil {
 		panic("whiteBlackList should not be nil")
 	}
@@ -123,39 +276,178 @@ func (b *Builder) Build() []*metricsstore.MetricsStore {
 	stores := []*metricsstore.MetricsStore{}
 	activeStoreNames := []string{}
 
-	for _, c := range b.enabledResources {
-		constructor, ok := availableStores[c]
-		if ok {
-			store := constructor(b)
-			activeStoreNames = append(activeStoreNames, c)
-			stores = append(stores, store)
+	b.activeResources = b.resolveActiveResources(d, true)
+	b.syncTracker = newSyncTracker()
+	b.openMetricsFamilies = map[string]OpenMetricsFamily{}
+
+	// Rollouts of kinds whose collector is no longer active are never
+	// pruned by a relist, so forget them now.
+	activeKinds := b.activeRolloutKinds()
+	for _, source := range rolloutSources {
+		if _, ok := activeKinds[source.kind]; !ok {
+			b.rolloutTracker.forgetKind(source.kind)
+		}
+	}
+
+	for _, c := range b.activeResources {
+		var store *metricsstore.MetricsStore
+		if constructor, ok := availableStores[c]; ok {
+			store = constructor(b)
+		} else if cr := b.customResource(c); cr != nil {
+			store = b.buildCustomResourceStore(cr)
+		} else {
+			continue
 		}
+		b.syncTracker.setCollector(store, c)
+		activeStoreNames = append(activeStoreNames, c)
+		stores = append(stores, store)
 	}
 
 	klog.Infof("Active collectors: %s", strings.Join(activeStoreNames, ","))
 
-	return stores
+	return stores, activeStoreNames
+}
+
+// SyncStatus returns the sync status of every store of the last Build.
+func (b *Builder) SyncStatus() []CollectorSyncStatus {
+	if b.syncTracker == nil {
+		return nil
+	}
+	return b.syncTracker.status()
+}
+
+// WriteRolloutMetrics writes the rollout duration metrics of the workloads
+// whose collector is active and accepted by include.
+func (b *Builder) WriteRolloutMetrics(w io.Writer, include func(collector string) bool) {
+	kinds := map[string]struct{}{}
+	for kind, c := range b.activeRolloutKinds() {
+		if include(c) {
+			kinds[kind] = struct{}{}
+		}
+	}
+	if len(kinds) > 0 {
+		b.rolloutTracker.writeAll(w, b.whiteBlackList, kinds)
+	}
+}
+
+// activeRolloutKinds maps the kinds of the workloads whose rollouts are
+// tracked by an active collector to the collector.
+func (b *Builder) activeRolloutKinds() map[string]string {
+	kinds := map[string]string{}
+	for _, c := range b.activeResources {
+		for _, source := range rolloutSources {
+			if source.collector == c {
+				kinds[source.kind] = c
+			}
+		}
+	}
+	return kinds
 }
 
 var availableStores = map[string]func(f *Builder) *metricsstore.MetricsStore{
-	"clonesets": func(b *Builder) *metricsstore.MetricsStore { return b.buildCloneSetStore() },
+	"broadcastjobs":       func(b *Builder) *metricsstore.MetricsStore { return b.buildBroadcastJobStore() },
+	"clonesets":           func(b *Builder) *metricsstore.MetricsStore { return b.buildCloneSetStore() },
+	"controllerrevisions": func(b *Builder) *metricsstore.MetricsStore { return b.buildControllerRevisionStore() },
+	"daemonsets":          func(b *Builder) *metricsstore.MetricsStore { return b.buildDaemonSetStore() },
+	"pods":                func(b *Builder) *metricsstore.MetricsStore { return b.buildPodStore() },
+	"sidecarsets":         func(b *Builder) *metricsstore.MetricsStore { return b.buildSidecarSetStore() },
+	"statefulsets":        func(b *Builder) *metricsstore.MetricsStore { return b.buildStatefulSetStore() },
+	"uniteddeployments":   func(b *Builder) *metricsstore.MetricsStore { return b.buildUnitedDeploymentStore() },
 }
 
-func collectorExists(name string) bool {
+// CollectorExists returns whether a collector with the given name is
+// available.
+func CollectorExists(name string) bool {
 	_, ok := availableStores[name]
 	return ok
 }
 
-func availableCollectors() []string {
+// AvailableCollectors returns the names of the built-in collectors, sorted.
+func AvailableCollectors() []string {
 	c := []string{}
 	for name := range availableStores {
 		c = append(c, name)
 	}
+	sort.Strings(c)
 	return c
 }
 
+func (b *Builder) buildBroadcastJobStore() *metricsstore.MetricsStore {
+	return b.buildStore(broadcastJobMetricFamilies(b.allowList(b.allowAnnotationsList, "broadcastjobs"), b.allowList(b.allowLabelsList, "broadcastjobs")), &kruiseappsv1alpha1.BroadcastJob{}, createBroadcastJobListWatch)
+}
+
 func (b *Builder) buildCloneSetStore() *metricsstore.MetricsStore {
-	return b.buildStore(clonesetMetricFamilies, &kruiseappsv1alpha1.CloneSet{}, createCloneSetListWatch)
+	return b.buildStore(clonesetMetricFamilies(b.allowList(b.allowAnnotationsList, "clonesets"), b.allowList(b.allowLabelsList, "clonesets")), &kruiseappsv1alpha1.CloneSet{}, createCloneSetListWatch)
+}
+
+func (b *Builder) buildDaemonSetStore() *metricsstore.MetricsStore {
+	return b.buildStore(daemonSetMetricFamilies(b.allowList(b.allowAnnotationsList, "daemonsets"), b.allowList(b.allowLabelsList, "daemonsets")), &kruiseappsv1alpha1.DaemonSet{}, createDaemonSetListWatch)
+}
+
+func (b *Builder) buildStatefulSetStore() *metricsstore.MetricsStore {
+	return b.buildStore(statefulSetMetricFamilies(b.allowList(b.allowAnnotationsList, "statefulsets"), b.allowList(b.allowLabelsList, "statefulsets")), &kruiseappsv1alpha1.StatefulSet{}, createStatefulSetListWatch)
+}
+
+func (b *Builder) buildUnitedDeploymentStore() *metricsstore.MetricsStore {
+	return b.buildStore(unitedDeploymentMetricFamilies(b.allowList(b.allowAnnotationsList, "uniteddeployments"), b.allowList(b.allowLabelsList, "uniteddeployments")), &kruiseappsv1alpha1.UnitedDeployment{}, createUnitedDeploymentListWatch)
+}
+
+func (b *Builder) buildSidecarSetStore() *metricsstore.MetricsStore {
+	return b.buildClusterScopedStore(sidecarSetMetricFamilies(b.allowList(b.allowAnnotationsList, "sidecarsets"), b.allowList(b.allowLabelsList, "sidecarsets")), &kruiseappsv1alpha1.SidecarSet{}, createSidecarSetListWatch)
+}
+
+func (b *Builder) buildControllerRevisionStore() *metricsstore.MetricsStore {
+	store := b.newMetricsStore(controllerRevisionMetricFamilies(b.allowList(b.allowAnnotationsList, "controllerrevisions"), b.allowList(b.allowLabelsList, "controllerrevisions")))
+	b.startReflector(b.namespaces, &appsv1.ControllerRevision{}, store, func(ns string) cache.ListerWatcher {
+		return createControllerRevisionListWatch(b.coreClient, ns)
+	})
+
+	return store
+}
+
+func (b *Builder) buildPodStore() *metricsstore.MetricsStore {
+	store := b.newMetricsStore(podMetricFamilies(b.allowList(b.allowAnnotationsList, "pods"), b.allowList(b.allowLabelsList, "pods")))
+	b.startReflector(b.namespaces, &v1.Pod{}, store, func(ns string) cache.ListerWatcher {
+		return createPodListWatch(b.coreClient, ns)
+	})
+
+	return store
+}
+
+func (b *Builder) buildCustomResourceStore(cr *customResource) *metricsstore.MetricsStore {
+	for name, f := range customResourceOpenMetricsFamilies(cr) {
+		b.openMetricsFamilies[name] = f
+	}
+	store := b.newMetricsStore(customResourceMetricFamilies(cr, b.allowList(b.allowAnnotationsList, cr.Name), b.allowList(b.allowLabelsList, cr.Name)))
+	namespaces := b.namespaces
+	if cr.ClusterScoped {
+		namespaces = ksmoptions.NamespaceList{metav1.NamespaceAll}
+	}
+	b.startNamedReflector(cr.gvr.String(), namespaces, &unstructured.Unstructured{}, store, func(ns string) cache.ListerWatcher {
+		return createCustomResourceListWatch(b.dynamicClient, cr.gvr, ns)
+	})
+
+	return store
+}
+
+// customResource returns the custom resource whose collector has the given
+// name, or nil if there is none.
+func (b *Builder) customResource(name string) *customResource {
+	for _, cr := range b.customResources {
+		if cr.Name == name {
+			return cr
+		}
+	}
+	return nil
+}
+
+// allowList returns the allow list for the given resource, falling back to
+// the one configured for all resources.
+func (b *Builder) allowList(lists map[string][]string, resource string) []string {
+	if l, ok := lists[resource]; ok {
+		return l
+	}
+	return lists[options.LabelWildcard]
 }
 
 func (b *Builder) buildStore(
@@ -163,18 +455,36 @@ func (b *Builder) buildStore(
 	expectedType interface{},
 	listWatchFunc func(kubeClient clientset.Interface, ns string) cache.ListerWatcher,
 ) *metricsstore.MetricsStore {
-	filteredMetricFamilies := metric.FilterMetricFamilies(b.whiteBlackList, metricFamilies)
+	store := b.newMetricsStore(metricFamilies)
+	b.reflectorPerNamespace(expectedType, store, listWatchFunc)
+
+	return store
+}
+
+// buildClusterScopedStore is like buildStore, but for resources that are not
+// namespaced and therefore must be listed only once regardless of the
+// configured namespaces.
+func (b *Builder) buildClusterScopedStore(
+	metricFamilies []metric.FamilyGenerator,
+	expectedType interface{},
+	listWatchFunc func(kubeClient clientset.Interface, ns string) cache.ListerWatcher,
+) *metricsstore.MetricsStore {
+	store := b.newMetricsStore(metricFamilies)
+	b.reflectorClusterScoped(expectedType, store, listWatchFunc)
+
+	return store
+}
+
+func (b *Builder) newMetricsStore(metricFamilies []metric.FamilyGenerator) *metricsstore.MetricsStore {
+	filteredMetricFamilies := recoverFamilyGenerators(metric.FilterMetricFamilies(b.whiteBlackList, metricFamilies))
 	composedMetricGenFuncs := metric.ComposeMetricGenFuncs(filteredMetricFamilies)
 
 	familyHeaders := metric.ExtractMetricFamilyHeaders(filteredMetricFamilies)
 
-	store := metricsstore.NewMetricsStore(
+	return metricsstore.NewMetricsStore(
 		familyHeaders,
 		composedMetricGenFuncs,
 	)
-	b.reflectorPerNamespace(expectedType, store, listWatchFunc)
-
-	return store
 }
 
 // reflectorPerNamespace creates a Kubernetes client-go reflector with the given
@@ -184,9 +494,57 @@ func (b *Builder) reflectorPerNamespace(
 	store cache.Store,
 	listWatchFunc func(kubeClient clientset.Interface, ns string) cache.ListerWatcher,
 ) {
-	lwf := func(ns string) cache.ListerWatcher { return listWatchFunc(b.kubeClient, ns) }
-	lw := listwatch.MultiNamespaceListerWatcher(b.namespaces, nil, lwf)
-	instrumentedListWatch := watch.NewInstrumentedListerWatcher(lw, b.metrics, reflect.TypeOf(expectedType).String())
-	reflector := cache.NewReflector(sharding.NewShardedListWatch(b.shard, b.totalShards, instrumentedListWatch), expectedType, store, 0)
+	b.startReflector(b.namespaces, expectedType, store, func(ns string) cache.ListerWatcher {
+		return listWatchFunc(b.kubeClient, ns)
+	})
+}
+
+// reflectorClusterScoped creates a single Kubernetes client-go reflector with
+// the given listWatchFunc across all namespaces and registers it with the
+// given store.
+func (b *Builder) reflectorClusterScoped(
+	expectedType interface{},
+	store cache.Store,
+	listWatchFunc func(kubeClient clientset.Interface, ns string) cache.ListerWatcher,
+) {
+	b.startReflector(ksmoptions.NamespaceList{metav1.NamespaceAll}, expectedType, store, func(ns string) cache.ListerWatcher {
+		return listWatchFunc(b.kubeClient, ns)
+	})
+}
+
+// startReflector starts a reflector of expectedType, instrumenting its list
+// and watch calls with the type name as resource.
+func (b *Builder) startReflector(
+	namespaces ksmoptions.NamespaceList,
+	expectedType interface{},
+	store cache.Store,
+	listWatchFunc func(ns string) cache.ListerWatcher,
+) {
+	b.startNamedReflector(reflect.TypeOf(expectedType).String(), namespaces, expectedType, store, listWatchFunc)
+}
+
+// startNamedReflector is like startReflector, but instruments the list and
+// watch calls with the given resource name. It is used for types such as
+// unstructured objects whose type name does not identify the resource.
+func (b *Builder) startNamedReflector(
+	resource string,
+	namespaces ksmoptions.NamespaceList,
+	expectedType interface{},
+	store cache.Store,
+	listWatchFunc func(ns string) cache.ListerWatcher,
+) {
+	ss := newStoreSync(namespaces)
+	b.syncTracker.add(store, ss)
+
+	lwf := func(ns string) cache.ListerWatcher {
+		return &syncedListerWatcher{ListerWatcher: listWatchFunc(ns), namespace: ns, sync: ss}
+	}
+	lw := listwatch.MultiNamespaceListerWatcher(namespaces, nil, lwf)
+	instrumentedListWatch := watch.NewInstrumentedListerWatcher(lw, b.metrics, resource)
+	target := b.rolloutTracker.wrapStore(expectedType, &syncedStore{Store: store, sync: ss})
+	if b.transitionTracker != nil {
+		target = b.transitionTracker.wrapStore(expectedType, target)
+	}
+	reflector := cache.NewReflector(sharding.NewShardedListWatch(b.shard, b.totalShards, instrumentedListWatch), expectedType, target, 0)
 	go reflector.Run(b.ctx.Done())
 }
@@ -29,11 +29,21 @@ import (
 )
 
 var (
+	descCloneSetAnnotationsName     = "kube_cloneset_annotations"
+	descCloneSetAnnotationsHelp     = "Kubernetes annotations converted to Prometheus labels."
 	descCloneSetLabelsName          = "kube_cloneset_labels"
 	descCloneSetLabelsHelp          = "Kubernetes labels converted to Prometheus labels."
 	descCloneSetLabelsDefaultLabels = []string{"namespace", "cloneset"}
 
-	clonesetMetricFamilies = []metric.FamilyGenerator{
+	clonesetUpdateStrategyTypes = []kruiseappsv1alpha1.CloneSetUpdateStrategyType{
+		kruiseappsv1alpha1.RecreateCloneSetUpdateStrategyType,
+		kruiseappsv1alpha1.InPlaceIfPossibleCloneSetUpdateStrategyType,
+		kruiseappsv1alpha1.InPlaceOnlyCloneSetUpdateStrategyType,
+	}
+)
+
+func clonesetMetricFamilies(allowAnnotationsList, allowLabelsList []string) []metric.FamilyGenerator {
+	return []metric.FamilyGenerator{
 		{
 			Name: "kube_cloneset_created",
 			Type: metric.Gauge,
@@ -66,6 +76,20 @@ var (
 				}
 			}),
 		},
+		{
+			Name: "kube_cloneset_status_replicas_ready",
+			Type: metric.Gauge,
+			Help: "The number of ready replicas per cloneset.",
+			GenerateFunc: wrapCloneSetFunc(func(d *kruiseappsv1alpha1.CloneSet) *metric.Family {
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							Value: float64(d.Status.ReadyReplicas),
+						},
+					},
+				}
+			}),
+		},
 		{
 			Name: "kube_cloneset_status_replicas_available",
 			Type: metric.Gauge,
@@ -136,6 +160,44 @@ var (
 				}
 			}),
 		},
+		{
+			Name: "kube_cloneset_status_update_revision",
+			Type: metric.Gauge,
+			Help: "Indicates the revision the cloneset is being updated to.",
+			GenerateFunc: wrapCloneSetFunc(func(d *kruiseappsv1alpha1.CloneSet) *metric.Family {
+				if d.Status.UpdateRevision == "" {
+					return &metric.Family{}
+				}
+
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							LabelKeys:   []string{"revision"},
+							LabelValues: []string{d.Status.UpdateRevision},
+							Value:       1,
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: "kube_cloneset_status_collision_count",
+			Type: metric.Gauge,
+			Help: "The count of hash collisions for the cloneset.",
+			GenerateFunc: wrapCloneSetFunc(func(d *kruiseappsv1alpha1.CloneSet) *metric.Family {
+				ms := []*metric.Metric{}
+
+				if d.Status.CollisionCount != nil {
+					ms = append(ms, &metric.Metric{
+						Value: float64(*d.Status.CollisionCount),
+					})
+				}
+
+				return &metric.Family{
+					Metrics: ms,
+				}
+			}),
+		},
 		{
 			Name: "kube_cloneset_status_condition",
 			Type: metric.Gauge,
@@ -165,12 +227,16 @@ var (
 			Type: metric.Gauge,
 			Help: "Number of desired pods for a cloneset.",
 			GenerateFunc: wrapCloneSetFunc(func(d *kruiseappsv1alpha1.CloneSet) *metric.Family {
+				ms := []*metric.Metric{}
+
+				if d.Spec.Replicas != nil {
+					ms = append(ms, &metric.Metric{
+						Value: float64(*d.Spec.Replicas),
+					})
+				}
+
 				return &metric.Family{
-					Metrics: []*metric.Metric{
-						{
-							Value: float64(*d.Spec.Replicas),
-						},
-					},
+					Metrics: ms,
 				}
 			}),
 		},
@@ -188,18 +254,36 @@ var (
 				}
 			}),
 		},
+		{
+			Name: "kube_cloneset_spec_strategy_partition",
+			Type: metric.Gauge,
+			Help: "The number of replicas kept at the old revision during a partitioned update of a cloneset.",
+			GenerateFunc: wrapCloneSetFunc(func(d *kruiseappsv1alpha1.CloneSet) *metric.Family {
+				ms := []*metric.Metric{}
+
+				if d.Spec.UpdateStrategy.Partition != nil {
+					ms = append(ms, &metric.Metric{
+						Value: float64(clonesetPartition(d)),
+					})
+				}
+
+				return &metric.Family{
+					Metrics: ms,
+				}
+			}),
+		},
 		{
 			Name: "kube_cloneset_spec_strategy_rollingupdate_max_unavailable",
 			Type: metric.Gauge,
 			Help: "Maximum number of unavailable replicas during a rolling update of a cloneset.",
 			GenerateFunc: wrapCloneSetFunc(func(d *kruiseappsv1alpha1.CloneSet) *metric.Family {
-				if d.Spec.UpdateStrategy.MaxUnavailable == nil {
+				if d.Spec.Replicas == nil || d.Spec.UpdateStrategy.MaxUnavailable == nil {
 					return &metric.Family{}
 				}
 
 				maxUnavailable, err := intstr.GetValueFromIntOrPercent(d.Spec.UpdateStrategy.MaxUnavailable, int(*d.Spec.Replicas), true)
 				if err != nil {
-					panic(err)
+					return generateError("kube_cloneset_spec_strategy_rollingupdate_max_unavailable", d, err)
 				}
 
 				return &metric.Family{
@@ -216,13 +300,13 @@ var (
 			Type: metric.Gauge,
 			Help: "Maximum number of replicas that can be scheduled above the desired number of replicas during a rolling update of a cloneset.",
 			GenerateFunc: wrapCloneSetFunc(func(d *kruiseappsv1alpha1.CloneSet) *metric.Family {
-				if d.Spec.UpdateStrategy.MaxSurge == nil {
+				if d.Spec.Replicas == nil || d.Spec.UpdateStrategy.MaxSurge == nil {
 					return &metric.Family{}
 				}
 
 				maxSurge, err := intstr.GetValueFromIntOrPercent(d.Spec.UpdateStrategy.MaxSurge, int(*d.Spec.Replicas), true)
 				if err != nil {
-					panic(err)
+					return generateError("kube_cloneset_spec_strategy_rollingupdate_max_surge", d, err)
 				}
 
 				return &metric.Family{
@@ -234,6 +318,123 @@ var (
 				}
 			}),
 		},
+		{
+			Name: "kube_cloneset_spec_strategy_type",
+			Type: metric.Gauge,
+			Help: "The update strategy type of a cloneset.",
+			GenerateFunc: wrapCloneSetFunc(func(d *kruiseappsv1alpha1.CloneSet) *metric.Family {
+				strategyType := d.Spec.UpdateStrategy.Type
+				if strategyType == "" {
+					strategyType = kruiseappsv1alpha1.RecreateCloneSetUpdateStrategyType
+				}
+
+				ms := make([]*metric.Metric, len(clonesetUpdateStrategyTypes))
+
+				for i, t := range clonesetUpdateStrategyTypes {
+					ms[i] = &metric.Metric{
+						LabelKeys:   []string{"type"},
+						LabelValues: []string{string(t)},
+						Value:       boolFloat64(strategyType == t),
+					}
+				}
+
+				return &metric.Family{
+					Metrics: ms,
+				}
+			}),
+		},
+		{
+			Name: "kube_cloneset_spec_strategy_inplace_grace_period_seconds",
+			Type: metric.Gauge,
+			Help: "Seconds a pod is kept not-ready before it is updated in-place.",
+			GenerateFunc: wrapCloneSetFunc(func(d *kruiseappsv1alpha1.CloneSet) *metric.Family {
+				ms := []*metric.Metric{}
+
+				if d.Spec.UpdateStrategy.InPlaceUpdateStrategy != nil {
+					ms = append(ms, &metric.Metric{
+						Value: float64(d.Spec.UpdateStrategy.InPlaceUpdateStrategy.GracePeriodSeconds),
+					})
+				}
+
+				return &metric.Family{
+					Metrics: ms,
+				}
+			}),
+		},
+		{
+			Name: "kube_cloneset_spec_strategy_priority_enabled",
+			Type: metric.Gauge,
+			Help: "Whether an update priority strategy is configured for the cloneset.",
+			GenerateFunc: wrapCloneSetFunc(func(d *kruiseappsv1alpha1.CloneSet) *metric.Family {
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							Value: boolFloat64(d.Spec.UpdateStrategy.PriorityStrategy != nil),
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: "kube_cloneset_spec_strategy_scatter_enabled",
+			Type: metric.Gauge,
+			Help: "Whether an update scatter strategy is configured for the cloneset.",
+			GenerateFunc: wrapCloneSetFunc(func(d *kruiseappsv1alpha1.CloneSet) *metric.Family {
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							Value: boolFloat64(len(d.Spec.UpdateStrategy.ScatterStrategy) > 0),
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: "kube_cloneset_spec_scale_strategy_pods_to_delete",
+			Type: metric.Gauge,
+			Help: "Number of pods explicitly requested for deletion by the scale strategy of a cloneset.",
+			GenerateFunc: wrapCloneSetFunc(func(d *kruiseappsv1alpha1.CloneSet) *metric.Family {
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							Value: float64(len(d.Spec.ScaleStrategy.PodsToDelete)),
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: "kube_cloneset_spec_min_ready_seconds",
+			Type: metric.Gauge,
+			Help: "Minimum number of seconds a new pod should be ready to be considered available.",
+			GenerateFunc: wrapCloneSetFunc(func(d *kruiseappsv1alpha1.CloneSet) *metric.Family {
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							Value: float64(d.Spec.MinReadySeconds),
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: "kube_cloneset_spec_revision_history_limit",
+			Type: metric.Gauge,
+			Help: "Number of old revisions retained for a cloneset.",
+			GenerateFunc: wrapCloneSetFunc(func(d *kruiseappsv1alpha1.CloneSet) *metric.Family {
+				ms := []*metric.Metric{}
+
+				if d.Spec.RevisionHistoryLimit != nil {
+					ms = append(ms, &metric.Metric{
+						Value: float64(*d.Spec.RevisionHistoryLimit),
+					})
+				}
+
+				return &metric.Family{
+					Metrics: ms,
+				}
+			}),
+		},
 		{
 			Name: "kube_cloneset_metadata_generation",
 			Type: metric.Gauge,
@@ -248,12 +449,29 @@ var (
 				}
 			}),
 		},
+		{
+			Name: descCloneSetAnnotationsName,
+			Type: metric.Gauge,
+			Help: descCloneSetAnnotationsHelp,
+			GenerateFunc: wrapCloneSetFunc(func(d *kruiseappsv1alpha1.CloneSet) *metric.Family {
+				annotationKeys, annotationValues := createPrometheusLabelKeysValues("annotation", d.Annotations, allowAnnotationsList)
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							LabelKeys:   annotationKeys,
+							LabelValues: annotationValues,
+							Value:       1,
+						},
+					},
+				}
+			}),
+		},
 		{
 			Name: descCloneSetLabelsName,
 			Type: metric.Gauge,
 			Help: descCloneSetLabelsHelp,
 			GenerateFunc: wrapCloneSetFunc(func(d *kruiseappsv1alpha1.CloneSet) *metric.Family {
-				labelKeys, labelValues := kubeLabelsToPrometheusLabels(d.Labels)
+				labelKeys, labelValues := createPrometheusLabelKeysValues("label", d.Labels, allowLabelsList)
 				return &metric.Family{
 					Metrics: []*metric.Metric{
 						{
@@ -266,7 +484,19 @@ var (
 			}),
 		},
 	}
-)
+}
+
+// clonesetPartition returns the partition of a cloneset capped at its desired
+// replicas, as the controller never keeps more pods than that at the old
+// revision. The partition of the vendored API is a plain integer, so there
+// is no percentage to resolve.
+func clonesetPartition(d *kruiseappsv1alpha1.CloneSet) int32 {
+	partition := *d.Spec.UpdateStrategy.Partition
+	if d.Spec.Replicas != nil && partition > *d.Spec.Replicas {
+		return *d.Spec.Replicas
+	}
+	return partition
+}
 
 func wrapCloneSetFunc(f func(*kruiseappsv1alpha1.CloneSet) *metric.Family) func(interface{}) *metric.Family {
 	return func(obj interface{}) *metric.Family {
@@ -0,0 +1,169 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"k8s.io/kube-state-metrics/pkg/metric"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+var (
+	descControllerRevisionAnnotationsName     = "kube_kruise_controllerrevision_annotations"
+	descControllerRevisionAnnotationsHelp     = "Kubernetes annotations converted to Prometheus labels."
+	descControllerRevisionLabelsName          = "kube_kruise_controllerrevision_labels"
+	descControllerRevisionLabelsHelp          = "Kubernetes labels converted to Prometheus labels."
+	descControllerRevisionLabelsDefaultLabels = []string{"namespace", "controllerrevision"}
+)
+
+func controllerRevisionMetricFamilies(allowAnnotationsList, allowLabelsList []string) []metric.FamilyGenerator {
+	return []metric.FamilyGenerator{
+		{
+			Name: "kube_kruise_controllerrevision_created",
+			Type: metric.Gauge,
+			Help: "Unix creation timestamp",
+			GenerateFunc: wrapControllerRevisionFunc(func(r *appsv1.ControllerRevision) *metric.Family {
+				ms := []*metric.Metric{}
+
+				if !r.CreationTimestamp.IsZero() {
+					ms = append(ms, &metric.Metric{
+						Value: float64(r.CreationTimestamp.Unix()),
+					})
+				}
+
+				return &metric.Family{
+					Metrics: ms,
+				}
+			}),
+		},
+		{
+			Name: "kube_kruise_controllerrevision_revision",
+			Type: metric.Gauge,
+			Help: "The revision number of the controllerrevision.",
+			GenerateFunc: wrapControllerRevisionFunc(func(r *appsv1.ControllerRevision) *metric.Family {
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							Value: float64(r.Revision),
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: "kube_kruise_controllerrevision_owner",
+			Type: metric.Gauge,
+			Help: "Information about the Kruise workload owning the controllerrevision.",
+			GenerateFunc: wrapControllerRevisionFunc(func(r *appsv1.ControllerRevision) *metric.Family {
+				owner := kruiseOwner(r)
+				if owner == nil {
+					return &metric.Family{}
+				}
+
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							LabelKeys:   []string{"owner_kind", "owner_name"},
+							LabelValues: []string{owner.Kind, owner.Name},
+							Value:       1,
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: descControllerRevisionAnnotationsName,
+			Type: metric.Gauge,
+			Help: descControllerRevisionAnnotationsHelp,
+			GenerateFunc: wrapControllerRevisionFunc(func(r *appsv1.ControllerRevision) *metric.Family {
+				annotationKeys, annotationValues := createPrometheusLabelKeysValues("annotation", r.Annotations, allowAnnotationsList)
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							LabelKeys:   annotationKeys,
+							LabelValues: annotationValues,
+							Value:       1,
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: descControllerRevisionLabelsName,
+			Type: metric.Gauge,
+			Help: descControllerRevisionLabelsHelp,
+			GenerateFunc: wrapControllerRevisionFunc(func(r *appsv1.ControllerRevision) *metric.Family {
+				labelKeys, labelValues := createPrometheusLabelKeysValues("label", r.Labels, allowLabelsList)
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							LabelKeys:   labelKeys,
+							LabelValues: labelValues,
+							Value:       1,
+						},
+					},
+				}
+			}),
+		},
+	}
+}
+
+func wrapControllerRevisionFunc(f func(*appsv1.ControllerRevision) *metric.Family) func(interface{}) *metric.Family {
+	return func(obj interface{}) *metric.Family {
+		controllerRevision := obj.(*appsv1.ControllerRevision)
+
+		metricFamily := f(controllerRevision)
+
+		for _, m := range metricFamily.Metrics {
+			m.LabelKeys = append(descControllerRevisionLabelsDefaultLabels, m.LabelKeys...)
+			m.LabelValues = append([]string{controllerRevision.Namespace, controllerRevision.Name}, m.LabelValues...)
+		}
+
+		return metricFamily
+	}
+}
+
+// createControllerRevisionListWatch lists and watches the controllerrevisions
+// of the given namespace, but only passes on the ones owned by a Kruise
+// workload.
+func createControllerRevisionListWatch(kubeClient kubernetes.Interface, ns string) cache.ListerWatcher {
+	return &cache.ListWatch{
+		ListFunc: func(opts metav1.ListOptions) (runtime.Object, error) {
+			list, err := kubeClient.AppsV1().ControllerRevisions(ns).List(opts)
+			if err != nil {
+				return nil, err
+			}
+
+			items := list.Items[:0]
+			for _, r := range list.Items {
+				if kruiseOwner(&r) != nil {
+					items = append(items, r)
+				}
+			}
+			list.Items = items
+			return list, nil
+		},
+		WatchFunc: func(opts metav1.ListOptions) (watch.Interface, error) {
+			return watchKruiseOwned(kubeClient.AppsV1().ControllerRevisions(ns).Watch(opts))
+		},
+	}
+}
@@ -0,0 +1,545 @@
+/*
+Copyright 2018 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/kube-state-metrics/pkg/metric"
+
+	"github.com/SchoIsles/kruise-state-metrics/pkg/options"
+)
+
+// ClusterLabel is the label holding the cluster name of every sample in
+// multi-cluster mode.
+const ClusterLabel = "cluster"
+
+// customResource is a validated custom resource config.
+type customResource struct {
+	options.CustomResource
+	gvr          schema.GroupVersionResource
+	prefix       string
+	objectLabel  string
+	defaultLabel []string
+}
+
+// compileCustomResource validates the config of a custom resource and fills
+// in its defaults. The labels of its metrics must not be one of
+// reservedLabels.
+func compileCustomResource(spec options.CustomResource, reservedLabels ...string) (*customResource, error) {
+	if spec.Version == "" || spec.Resource == "" || spec.Kind == "" {
+		return nil, errors.New("version, resource and kind must be set")
+	}
+
+	cr := &customResource{
+		CustomResource: spec,
+		gvr:            schema.GroupVersionResource{Group: spec.Group, Version: spec.Version, Resource: spec.Resource},
+		prefix:         spec.MetricNamePrefix,
+		objectLabel:    sanitizeLabelName(strings.ToLower(spec.Kind)),
+	}
+	if cr.Name == "" {
+		cr.Name = spec.Resource
+	}
+	if cr.prefix == "" {
+		cr.prefix = "kube_" + cr.objectLabel
+	}
+	if !model.IsValidMetricName(model.LabelValue(cr.prefix)) {
+		return nil, errors.Errorf("invalid metric name prefix %q", cr.prefix)
+	}
+	cr.defaultLabel = []string{cr.objectLabel}
+	if !spec.ClusterScoped {
+		cr.defaultLabel = []string{"namespace", cr.objectLabel}
+	}
+	for _, l := range reservedLabels {
+		if l == cr.objectLabel {
+			return nil, errors.Errorf("kind %s results in the reserved label %q", spec.Kind, l)
+		}
+	}
+
+	names := map[string]struct{}{"created": {}, "labels": {}, "annotations": {}}
+	for _, m := range spec.Metrics {
+		if _, ok := names[m.Name]; ok {
+			return nil, errors.Errorf("duplicate metric %q", m.Name)
+		}
+		names[m.Name] = struct{}{}
+		if err := cr.validateMetric(m, reservedLabels); err != nil {
+			return nil, errors.Wrapf(err, "metric %q", m.Name)
+		}
+	}
+
+	return cr, nil
+}
+
+func (cr *customResource) validateMetric(m options.CustomResourceMetric, reservedLabels []string) error {
+	if !model.IsValidMetricName(model.LabelValue(cr.prefix + "_" + m.Name)) {
+		return errors.New("invalid metric name")
+	}
+
+	labels := map[string]struct{}{}
+	for _, l := range cr.defaultLabel {
+		labels[l] = struct{}{}
+	}
+	addLabel := func(l string) error {
+		if !model.LabelName(l).IsValid() {
+			return errors.Errorf("invalid label name %q", l)
+		}
+		for _, reserved := range reservedLabels {
+			if l == reserved {
+				return errors.Errorf("label %q is reserved", l)
+			}
+		}
+		if _, ok := labels[l]; ok {
+			return errors.Errorf("duplicate label %q", l)
+		}
+		labels[l] = struct{}{}
+		return nil
+	}
+	for l := range m.LabelsFromPath {
+		if err := addLabel(l); err != nil {
+			return err
+		}
+	}
+	if m.LabelFromKey != "" {
+		if err := addLabel(m.LabelFromKey); err != nil {
+			return err
+		}
+	}
+
+	switch m.Type {
+	case options.CustomResourceGauge:
+	case options.CustomResourceStateSet:
+		if len(m.States) == 0 {
+			return errors.New("states must be set for a state set")
+		}
+		if err := addLabel(stateLabel(m)); err != nil {
+			return err
+		}
+	case options.CustomResourceInfo:
+		if len(m.LabelsFromPath) == 0 {
+			return errors.New("labelsFromPath must be set for an info metric")
+		}
+	default:
+		return errors.Errorf("unsupported type %q, expected %s, %s or %s", m.Type,
+			options.CustomResourceGauge, options.CustomResourceStateSet, options.CustomResourceInfo)
+	}
+	return nil
+}
+
+// ValidateCustomResources returns the collector names of the given custom
+// resource configs, or an error if any of them is invalid, uses one of
+// reservedLabels or their collector names are not unique.
+func ValidateCustomResources(specs []options.CustomResource, reservedLabels ...string) ([]string, error) {
+	crs, err := compileCustomResources(specs, reservedLabels...)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(crs))
+	for _, cr := range crs {
+		names = append(names, cr.Name)
+	}
+	return names, nil
+}
+
+// compileCustomResources compiles the given custom resource configs and makes
+// sure their collector names and metric families are unique, among each other
+// and with the built-in collectors, as duplicate families make the exposition
+// invalid.
+func compileCustomResources(specs []options.CustomResource, reservedLabels ...string) ([]*customResource, error) {
+	crs := []*customResource{}
+	names := map[string]struct{}{}
+	prefixes := map[string]string{}
+	families := map[string]string{}
+	for _, spec := range specs {
+		cr, err := compileCustomResource(spec, reservedLabels...)
+		if err != nil {
+			return nil, errors.Wrapf(err, "custom resource %s", spec.Resource)
+		}
+		if _, ok := names[cr.Name]; ok || CollectorExists(cr.Name) {
+			return nil, errors.Errorf("custom resource %s: collector %s already exists", spec.Resource, cr.Name)
+		}
+		if family, ok := builtinFamilyWithPrefix(cr.prefix); ok {
+			return nil, errors.Errorf("custom resource %s: metric name prefix %s is reserved by the built-in metric %s", spec.Resource, cr.prefix, family)
+		}
+		if other, ok := prefixes[cr.prefix]; ok {
+			return nil, errors.Errorf("custom resource %s: metric name prefix %s is already used by custom resource %s", spec.Resource, cr.prefix, other)
+		}
+		for _, family := range cr.familyNames() {
+			if other, ok := families[family]; ok {
+				return nil, errors.Errorf("custom resource %s: metric %s is already generated by custom resource %s", spec.Resource, family, other)
+			}
+			families[family] = spec.Resource
+		}
+		names[cr.Name] = struct{}{}
+		prefixes[cr.prefix] = spec.Resource
+		crs = append(crs, cr)
+	}
+	return crs, nil
+}
+
+// familyNames returns the names of the metric families of a custom resource.
+func (cr *customResource) familyNames() []string {
+	names := []string{cr.prefix + "_created", cr.prefix + "_annotations", cr.prefix + "_labels"}
+	for _, m := range cr.Metrics {
+		names = append(names, cr.prefix+"_"+m.Name)
+	}
+	return names
+}
+
+// builtinMetricFamilies are the metric families of the built-in collectors.
+var builtinMetricFamilies = []func(allowAnnotationsList, allowLabelsList []string) []metric.FamilyGenerator{
+	broadcastJobMetricFamilies,
+	clonesetMetricFamilies,
+	controllerRevisionMetricFamilies,
+	daemonSetMetricFamilies,
+	podMetricFamilies,
+	sidecarSetMetricFamilies,
+	statefulSetMetricFamilies,
+	unitedDeploymentMetricFamilies,
+}
+
+// builtinFamilyWithPrefix returns a metric family of a built-in collector or
+// of the rollout tracker that starts with the given prefix, if any.
+func builtinFamilyWithPrefix(prefix string) (string, bool) {
+	names := append([]string{}, rolloutFamilies...)
+	for _, families := range builtinMetricFamilies {
+		for _, f := range families(nil, nil) {
+			names = append(names, f.Name)
+		}
+	}
+	for _, name := range names {
+		if strings.HasPrefix(name, prefix+"_") {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+func stateLabel(m options.CustomResourceMetric) string {
+	if m.StateLabel == "" {
+		return "state"
+	}
+	return m.StateLabel
+}
+
+func customResourceMetricFamilies(cr *customResource, allowAnnotationsList, allowLabelsList []string) []metric.FamilyGenerator {
+	families := []metric.FamilyGenerator{
+		{
+			Name: cr.prefix + "_created",
+			Type: metric.Gauge,
+			Help: "Unix creation timestamp",
+			GenerateFunc: wrapCustomResourceFunc(cr, func(u *unstructured.Unstructured) *metric.Family {
+				ms := []*metric.Metric{}
+
+				if created := u.GetCreationTimestamp(); !created.IsZero() {
+					ms = append(ms, &metric.Metric{
+						Value: float64(created.Unix()),
+					})
+				}
+
+				return &metric.Family{
+					Metrics: ms,
+				}
+			}),
+		},
+	}
+
+	for _, m := range cr.Metrics {
+		families = append(families, customResourceMetricFamily(cr, m))
+	}
+
+	return append(families,
+		metric.FamilyGenerator{
+			Name: cr.prefix + "_annotations",
+			Type: metric.Gauge,
+			Help: "Kubernetes annotations converted to Prometheus labels.",
+			GenerateFunc: wrapCustomResourceFunc(cr, func(u *unstructured.Unstructured) *metric.Family {
+				annotationKeys, annotationValues := createPrometheusLabelKeysValues("annotation", u.GetAnnotations(), allowAnnotationsList)
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							LabelKeys:   annotationKeys,
+							LabelValues: annotationValues,
+							Value:       1,
+						},
+					},
+				}
+			}),
+		},
+		metric.FamilyGenerator{
+			Name: cr.prefix + "_labels",
+			Type: metric.Gauge,
+			Help: "Kubernetes labels converted to Prometheus labels.",
+			GenerateFunc: wrapCustomResourceFunc(cr, func(u *unstructured.Unstructured) *metric.Family {
+				labelKeys, labelValues := createPrometheusLabelKeysValues("label", u.GetLabels(), allowLabelsList)
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							LabelKeys:   labelKeys,
+							LabelValues: labelValues,
+							Value:       1,
+						},
+					},
+				}
+			}),
+		},
+	)
+}
+
+// customResourceOpenMetricsFamilies returns how the configured state set and
+// info metrics of a custom resource are exposed in the OpenMetrics format.
+func customResourceOpenMetricsFamilies(cr *customResource) map[string]OpenMetricsFamily {
+	families := map[string]OpenMetricsFamily{}
+	for _, m := range cr.Metrics {
+		switch m.Type {
+		case options.CustomResourceStateSet:
+			families[cr.prefix+"_"+m.Name] = OpenMetricsFamily{Type: OpenMetricsStateSet, StateLabel: stateLabel(m)}
+		case options.CustomResourceInfo:
+			families[cr.prefix+"_"+m.Name] = OpenMetricsFamily{Type: OpenMetricsInfo}
+		}
+	}
+	return families
+}
+
+// customResourceMetricFamily returns the family generator of a configured
+// metric of a custom resource.
+func customResourceMetricFamily(cr *customResource, m options.CustomResourceMetric) metric.FamilyGenerator {
+	name := cr.prefix + "_" + m.Name
+	help := m.Help
+	if help == "" {
+		help = fmt.Sprintf("Value of %s of the %s.", joinPath(m.Path, m.ValuePath), cr.Kind)
+	}
+
+	labelKeys := make([]string, 0, len(m.LabelsFromPath))
+	for l := range m.LabelsFromPath {
+		labelKeys = append(labelKeys, l)
+	}
+	sort.Strings(labelKeys)
+
+	return metric.FamilyGenerator{
+		Name: name,
+		Type: metric.Gauge,
+		Help: help,
+		GenerateFunc: wrapCustomResourceFunc(cr, func(u *unstructured.Unstructured) *metric.Family {
+			ms := []*metric.Metric{}
+
+			items, err := customResourceItems(u.Object, m)
+			if err != nil {
+				return generateError(name, u, err)
+			}
+			for _, item := range items {
+				keys := append([]string{}, labelKeys...)
+				values := make([]string, 0, len(labelKeys)+1)
+				for _, l := range labelKeys {
+					v, _ := lookupPath(item.node, m.LabelsFromPath[l])
+					values = append(values, customResourceLabelValue(v))
+				}
+				if m.LabelFromKey != "" {
+					keys = append(keys, m.LabelFromKey)
+					values = append(values, item.key)
+				}
+
+				switch m.Type {
+				case options.CustomResourceGauge:
+					v, ok := lookupPath(item.node, m.ValuePath)
+					if !ok || v == nil {
+						continue
+					}
+					value, err := customResourceValue(v)
+					if err != nil {
+						return generateError(name, u, errors.Wrap(err, joinPath(m.Path, m.ValuePath)))
+					}
+					ms = append(ms, &metric.Metric{LabelKeys: keys, LabelValues: values, Value: value})
+				case options.CustomResourceStateSet:
+					v, ok := lookupPath(item.node, m.ValuePath)
+					if !ok {
+						continue
+					}
+					state := customResourceLabelValue(v)
+					for _, s := range m.States {
+						ms = append(ms, &metric.Metric{
+							LabelKeys:   append(append([]string{}, keys...), stateLabel(m)),
+							LabelValues: append(append([]string{}, values...), s),
+							Value:       boolFloat64(s == state),
+						})
+					}
+				case options.CustomResourceInfo:
+					ms = append(ms, &metric.Metric{LabelKeys: keys, LabelValues: values, Value: 1})
+				}
+			}
+
+			return &metric.Family{
+				Metrics: ms,
+			}
+		}),
+	}
+}
+
+// customResourceItem is a node series are generated from, along with its key
+// if it is an item of a map.
+type customResourceItem struct {
+	key  string
+	node interface{}
+}
+
+// customResourceItems returns the nodes the series of m are generated from:
+// every item of the list or map at the path of m, or the node at the path
+// itself. The items of a list can only be told apart by labelsFromPath, so
+// without it a list is an error rather than a set of identical series.
+func customResourceItems(obj map[string]interface{}, m options.CustomResourceMetric) ([]customResourceItem, error) {
+	node, ok := lookupPath(obj, m.Path)
+	if !ok {
+		return nil, nil
+	}
+
+	switch n := node.(type) {
+	case []interface{}:
+		if len(m.LabelsFromPath) == 0 {
+			return nil, errors.Errorf("%s is a list, labelsFromPath must be set to tell its items apart", m.Path)
+		}
+		items := make([]customResourceItem, 0, len(n))
+		for _, item := range n {
+			items = append(items, customResourceItem{node: item})
+		}
+		return items, nil
+	case map[string]interface{}:
+		if m.LabelFromKey == "" {
+			break
+		}
+		keys := make([]string, 0, len(n))
+		for k := range n {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		items := make([]customResourceItem, 0, len(n))
+		for _, k := range keys {
+			items = append(items, customResourceItem{key: k, node: n[k]})
+		}
+		return items, nil
+	}
+	return []customResourceItem{{node: node}}, nil
+}
+
+// lookupPath returns the node at the dot separated path below node.
+func lookupPath(node interface{}, path string) (interface{}, bool) {
+	if path == "" {
+		return node, true
+	}
+	for _, field := range strings.Split(path, ".") {
+		m, ok := node.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if node, ok = m[field]; !ok {
+			return nil, false
+		}
+	}
+	return node, true
+}
+
+// joinPath joins two dot separated paths, either of which may be empty.
+func joinPath(a, b string) string {
+	return strings.Trim(a+"."+b, ".")
+}
+
+// customResourceValue converts a field of an unstructured object to a
+// metric value. Boolean strings such as the "True" and "False" of condition
+// statuses are converted to 1 and 0.
+func customResourceValue(v interface{}) (float64, error) {
+	switch value := v.(type) {
+	case int64:
+		return float64(value), nil
+	case float64:
+		return value, nil
+	case bool:
+		return boolFloat64(value), nil
+	case string:
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f, nil
+		}
+		if b, err := strconv.ParseBool(value); err == nil {
+			return boolFloat64(b), nil
+		}
+		if t, err := time.Parse(time.RFC3339, value); err == nil {
+			return float64(t.Unix()), nil
+		}
+		if q, err := resource.ParseQuantity(value); err == nil {
+			return float64(q.MilliValue()) / 1000, nil
+		}
+		return 0, errors.Errorf("cannot convert %q to a number", value)
+	}
+	return 0, errors.Errorf("cannot convert %T to a number", v)
+}
+
+// customResourceLabelValue converts a field of an unstructured object to a
+// label value. Lists, maps and missing fields result in an empty value.
+func customResourceLabelValue(v interface{}) string {
+	switch value := v.(type) {
+	case string:
+		return value
+	case int64:
+		return strconv.FormatInt(value, 10)
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(value)
+	}
+	return ""
+}
+
+func wrapCustomResourceFunc(cr *customResource, f func(*unstructured.Unstructured) *metric.Family) func(interface{}) *metric.Family {
+	return func(obj interface{}) *metric.Family {
+		u := obj.(*unstructured.Unstructured)
+
+		metricFamily := f(u)
+
+		values := []string{u.GetName()}
+		if !cr.ClusterScoped {
+			values = []string{u.GetNamespace(), u.GetName()}
+		}
+		for _, m := range metricFamily.Metrics {
+			m.LabelKeys = append(cr.defaultLabel, m.LabelKeys...)
+			m.LabelValues = append(values, m.LabelValues...)
+		}
+
+		return metricFamily
+	}
+}
+
+func createCustomResourceListWatch(dynamicClient dynamic.Interface, gvr schema.GroupVersionResource, ns string) cache.ListerWatcher {
+	return &cache.ListWatch{
+		ListFunc: func(opts metav1.ListOptions) (runtime.Object, error) {
+			return dynamicClient.Resource(gvr).Namespace(ns).List(opts)
+		},
+		WatchFunc: func(opts metav1.ListOptions) (watch.Interface, error) {
+			return dynamicClient.Resource(gvr).Namespace(ns).Watch(opts)
+		},
+	}
+}
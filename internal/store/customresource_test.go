@@ -0,0 +1,496 @@
+/*
+Copyright 2018 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"io/ioutil"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+
+	"github.com/SchoIsles/kruise-state-metrics/pkg/options"
+)
+
+var testObject = map[string]interface{}{
+	"spec": map[string]interface{}{
+		"image": "nginx",
+		"limits": map[string]interface{}{
+			"cpu":    "500m",
+			"memory": "1Gi",
+		},
+	},
+	"status": map[string]interface{}{
+		"succeeded": int64(3),
+		"conditions": []interface{}{
+			map[string]interface{}{"type": "Ready", "status": "True"},
+			map[string]interface{}{"type": "Failed", "status": "False"},
+		},
+	},
+}
+
+func TestLookupPath(t *testing.T) {
+	tests := []struct {
+		path   string
+		want   interface{}
+		wantOK bool
+	}{
+		{path: "", want: testObject, wantOK: true},
+		{path: "status.succeeded", want: int64(3), wantOK: true},
+		{path: "spec.limits.cpu", want: "500m", wantOK: true},
+		{path: "spec.missing", wantOK: false},
+		{path: "spec.image.name", wantOK: false},
+		{path: "status.conditions.type", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, ok := lookupPath(testObject, tt.path)
+			if ok != tt.wantOK {
+				t.Fatalf("lookupPath(%q) ok = %v, want %v", tt.path, ok, tt.wantOK)
+			}
+			if ok && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("lookupPath(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCustomResourceItems(t *testing.T) {
+	limits := testObject["spec"].(map[string]interface{})["limits"]
+	conditions := testObject["status"].(map[string]interface{})["conditions"].([]interface{})
+
+	tests := []struct {
+		name    string
+		metric  options.CustomResourceMetric
+		want    []customResourceItem
+		wantErr bool
+	}{
+		{
+			name:   "scalar",
+			metric: options.CustomResourceMetric{Path: "status.succeeded"},
+			want:   []customResourceItem{{node: int64(3)}},
+		},
+		{
+			name:   "missing",
+			metric: options.CustomResourceMetric{Path: "status.missing"},
+			want:   nil,
+		},
+		{
+			name:   "list",
+			metric: options.CustomResourceMetric{Path: "status.conditions", LabelsFromPath: map[string]string{"type": "type"}},
+			want:   []customResourceItem{{node: conditions[0]}, {node: conditions[1]}},
+		},
+		{
+			name:    "list without labels",
+			metric:  options.CustomResourceMetric{Path: "status.conditions", ValuePath: "status"},
+			wantErr: true,
+		},
+		{
+			name:   "map without key label",
+			metric: options.CustomResourceMetric{Path: "spec.limits"},
+			want:   []customResourceItem{{node: limits}},
+		},
+		{
+			name:   "map with key label",
+			metric: options.CustomResourceMetric{Path: "spec.limits", LabelFromKey: "resource"},
+			want:   []customResourceItem{{key: "cpu", node: "500m"}, {key: "memory", node: "1Gi"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := customResourceItems(testObject, tt.metric)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("customResourceItems() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("customResourceItems() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCustomResourceValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   interface{}
+		want    float64
+		wantErr bool
+	}{
+		{name: "int", value: int64(3), want: 3},
+		{name: "float", value: 0.5, want: 0.5},
+		{name: "true", value: true, want: 1},
+		{name: "false", value: false, want: 0},
+		{name: "numeric string", value: "42", want: 42},
+		{name: "true string", value: "True", want: 1},
+		{name: "false string", value: "False", want: 0},
+		{name: "timestamp", value: "2020-01-01T00:00:00Z", want: 1577836800},
+		{name: "milli quantity", value: "500m", want: 0.5},
+		{name: "binary quantity", value: "1Gi", want: 1 << 30},
+		{name: "text", value: "nginx", wantErr: true},
+		{name: "map", value: map[string]interface{}{}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := customResourceValue(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("customResourceValue(%v) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("customResourceValue(%v) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileCustomResource(t *testing.T) {
+	base := func(metrics ...options.CustomResourceMetric) options.CustomResource {
+		return options.CustomResource{
+			Group:    "apps.kruise.io",
+			Version:  "v1alpha1",
+			Resource: "imagepulljobs",
+			Kind:     "ImagePullJob",
+			Metrics:  metrics,
+		}
+	}
+
+	tests := []struct {
+		name        string
+		spec        options.CustomResource
+		wantErr     string
+		wantName    string
+		wantPrefix  string
+		wantDefault []string
+	}{
+		{
+			name:        "defaults",
+			spec:        base(options.CustomResourceMetric{Name: "status_succeeded", Type: options.CustomResourceGauge, Path: "status.succeeded"}),
+			wantName:    "imagepulljobs",
+			wantPrefix:  "kube_imagepulljob",
+			wantDefault: []string{"namespace", "imagepulljob"},
+		},
+		{
+			name: "cluster scoped with overrides",
+			spec: func() options.CustomResource {
+				s := base()
+				s.Name, s.MetricNamePrefix, s.ClusterScoped = "jobs", "kruise_job", true
+				return s
+			}(),
+			wantName:    "jobs",
+			wantPrefix:  "kruise_job",
+			wantDefault: []string{"imagepulljob"},
+		},
+		{
+			name:    "missing kind",
+			spec:    options.CustomResource{Version: "v1", Resource: "things"},
+			wantErr: "version, resource and kind must be set",
+		},
+		{
+			name: "invalid prefix",
+			spec: func() options.CustomResource {
+				s := base()
+				s.MetricNamePrefix = "kube-job"
+				return s
+			}(),
+			wantErr: "invalid metric name prefix",
+		},
+		{
+			name:    "reserved metric name",
+			spec:    base(options.CustomResourceMetric{Name: "labels", Type: options.CustomResourceGauge}),
+			wantErr: `duplicate metric "labels"`,
+		},
+		{
+			name:    "unsupported type",
+			spec:    base(options.CustomResourceMetric{Name: "x", Type: "counter"}),
+			wantErr: `unsupported type "counter"`,
+		},
+		{
+			name:    "state set without states",
+			spec:    base(options.CustomResourceMetric{Name: "phase", Type: options.CustomResourceStateSet, Path: "status.phase"}),
+			wantErr: "states must be set",
+		},
+		{
+			name:    "info without labels",
+			spec:    base(options.CustomResourceMetric{Name: "info", Type: options.CustomResourceInfo}),
+			wantErr: "labelsFromPath must be set",
+		},
+		{
+			name: "label clashing with default label",
+			spec: base(options.CustomResourceMetric{Name: "info", Type: options.CustomResourceInfo,
+				LabelsFromPath: map[string]string{"namespace": "spec.namespace"}}),
+			wantErr: `duplicate label "namespace"`,
+		},
+		{
+			name: "state label clashing with key label",
+			spec: base(options.CustomResourceMetric{Name: "phase", Type: options.CustomResourceStateSet,
+				LabelFromKey: "state", States: []string{"Running"}}),
+			wantErr: `duplicate label "state"`,
+		},
+		{
+			name: "invalid label",
+			spec: base(options.CustomResourceMetric{Name: "info", Type: options.CustomResourceInfo,
+				LabelsFromPath: map[string]string{"image-name": "spec.image"}}),
+			wantErr: `invalid label name "image-name"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cr, err := compileCustomResource(tt.spec)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if cr.Name != tt.wantName || cr.prefix != tt.wantPrefix || !reflect.DeepEqual(cr.defaultLabel, tt.wantDefault) {
+				t.Errorf("got name %q, prefix %q, default labels %v, want %q, %q, %v",
+					cr.Name, cr.prefix, cr.defaultLabel, tt.wantName, tt.wantPrefix, tt.wantDefault)
+			}
+		})
+	}
+}
+
+func TestCompileCustomResourceReservedLabels(t *testing.T) {
+	spec := func(kind string, m options.CustomResourceMetric) options.CustomResource {
+		return options.CustomResource{Version: "v1", Resource: "things", Kind: kind, Metrics: []options.CustomResourceMetric{m}}
+	}
+	gauge := options.CustomResourceMetric{Name: "value", Type: options.CustomResourceGauge}
+
+	tests := []struct {
+		name    string
+		spec    options.CustomResource
+		wantErr string
+	}{
+		{
+			name: "unreserved labels",
+			spec: spec("Thing", options.CustomResourceMetric{Name: "info", Type: options.CustomResourceInfo,
+				LabelsFromPath: map[string]string{"cluster_name": "spec.cluster"}}),
+		},
+		{
+			name: "label from path",
+			spec: spec("Thing", options.CustomResourceMetric{Name: "info", Type: options.CustomResourceInfo,
+				LabelsFromPath: map[string]string{"cluster": "spec.cluster"}}),
+			wantErr: `label "cluster" is reserved`,
+		},
+		{
+			name:    "label from key",
+			spec:    spec("Thing", options.CustomResourceMetric{Name: "value", Type: options.CustomResourceGauge, Path: "spec.clusters", LabelFromKey: "cluster"}),
+			wantErr: `label "cluster" is reserved`,
+		},
+		{
+			name: "state label",
+			spec: spec("Thing", options.CustomResourceMetric{Name: "phase", Type: options.CustomResourceStateSet,
+				StateLabel: "cluster", States: []string{"a"}}),
+			wantErr: `label "cluster" is reserved`,
+		},
+		{
+			name:    "object label",
+			spec:    spec("Cluster", gauge),
+			wantErr: `reserved label "cluster"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := compileCustomResource(tt.spec); err != nil {
+				t.Fatalf("unexpected error without reserved labels: %v", err)
+			}
+			_, err := compileCustomResource(tt.spec, ClusterLabel)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestCompileCustomResources(t *testing.T) {
+	spec := func(name, kind, prefix string, metrics ...string) options.CustomResource {
+		s := options.CustomResource{Name: name, Version: "v1alpha1", Resource: name, Kind: kind, MetricNamePrefix: prefix}
+		for _, m := range metrics {
+			s.Metrics = append(s.Metrics, options.CustomResourceMetric{Name: m, Type: options.CustomResourceGauge})
+		}
+		return s
+	}
+
+	tests := []struct {
+		name    string
+		specs   []options.CustomResource
+		wantErr string
+	}{
+		{
+			name:  "distinct",
+			specs: []options.CustomResource{spec("imagepulljobs", "ImagePullJob", ""), spec("nodeimages", "NodeImage", "")},
+		},
+		{
+			name:    "duplicate collector",
+			specs:   []options.CustomResource{spec("imagepulljobs", "ImagePullJob", ""), spec("imagepulljobs", "NodeImage", "")},
+			wantErr: "collector imagepulljobs already exists",
+		},
+		{
+			name:    "built-in collector",
+			specs:   []options.CustomResource{spec("clonesets", "ImagePullJob", "")},
+			wantErr: "collector clonesets already exists",
+		},
+		{
+			name:    "duplicate kind",
+			specs:   []options.CustomResource{spec("imagepulljobs", "ImagePullJob", ""), spec("jobs", "ImagePullJob", "")},
+			wantErr: "prefix kube_imagepulljob is already used by custom resource imagepulljobs",
+		},
+		{
+			name:    "built-in prefix",
+			specs:   []options.CustomResource{spec("clones", "CloneSet", "")},
+			wantErr: "prefix kube_cloneset is reserved",
+		},
+		{
+			name:    "prefix of built-in metrics",
+			specs:   []options.CustomResource{spec("rollouts", "Rollout", "kruise")},
+			wantErr: "prefix kruise is reserved",
+		},
+		{
+			name: "overlapping prefixes",
+			specs: []options.CustomResource{
+				spec("imagepulljobs", "ImagePullJob", "kube_job", "status_succeeded"),
+				spec("jobstatus", "JobStatus", "kube_job_status", "succeeded"),
+			},
+			wantErr: "metric kube_job_status_succeeded is already generated by custom resource imagepulljobs",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := compileCustomResources(tt.specs)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestCustomResourceOpenMetricsFamilies(t *testing.T) {
+	cr, err := compileCustomResource(options.CustomResource{
+		Version:  "v1alpha1",
+		Resource: "imagepulljobs",
+		Kind:     "ImagePullJob",
+		Metrics: []options.CustomResourceMetric{
+			{Name: "status_succeeded", Type: options.CustomResourceGauge, Path: "status.succeeded"},
+			{Name: "status_phase", Type: options.CustomResourceStateSet, Path: "status.phase", StateLabel: "phase", States: []string{"Running"}},
+			{Name: "info", Type: options.CustomResourceInfo, LabelsFromPath: map[string]string{"image": "spec.image"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]OpenMetricsFamily{
+		"kube_imagepulljob_status_phase": {Type: OpenMetricsStateSet, StateLabel: "phase"},
+		"kube_imagepulljob_info":         {Type: OpenMetricsInfo},
+	}
+	if got := customResourceOpenMetricsFamilies(cr); !reflect.DeepEqual(got, want) {
+		t.Errorf("customResourceOpenMetricsFamilies() = %v, want %v", got, want)
+	}
+}
+
+// TestREADMECustomResources generates the metrics of the custom resource
+// example of the README.
+func TestREADMECustomResources(t *testing.T) {
+	readme, err := ioutil.ReadFile("../../README.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var example []byte
+	for _, block := range regexp.MustCompile("(?s)```yaml\n(.*?)```").FindAllSubmatch(readme, -1) {
+		if strings.HasPrefix(string(block[1]), "customResources:") {
+			example = block[1]
+		}
+	}
+	if example == nil {
+		t.Fatal("custom resource example not found in README.md")
+	}
+
+	config := &options.Config{}
+	if err := yaml.UnmarshalStrict(example, config); err != nil {
+		t.Fatal(err)
+	}
+	crs, err := compileCustomResources(config.CustomResources)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps.kruise.io/v1alpha1",
+		"kind":       "ImagePullJob",
+		"metadata": map[string]interface{}{
+			"namespace":         "ns",
+			"name":              "job",
+			"creationTimestamp": "2020-01-01T00:00:00Z",
+		},
+		"spec": map[string]interface{}{"image": "nginx"},
+		"status": map[string]interface{}{
+			"succeeded": int64(3),
+			"phase":     "Running",
+			"conditions": []interface{}{
+				map[string]interface{}{"type": "Ready", "status": "True"},
+				map[string]interface{}{"type": "Failed", "status": "False"},
+			},
+		},
+	}}
+
+	var out strings.Builder
+	for _, f := range customResourceMetricFamilies(crs[0], nil, nil) {
+		errorsBefore := testutil.ToFloat64(generateErrorsTotal.WithLabelValues(f.Name))
+		out.Write(f.Generate(job).ByteSlice())
+		if errs := testutil.ToFloat64(generateErrorsTotal.WithLabelValues(f.Name)) - errorsBefore; errs != 0 {
+			t.Errorf("%d errors generating %s", int(errs), f.Name)
+		}
+	}
+
+	for _, want := range []string{
+		`kube_imagepulljob_created{namespace="ns",imagepulljob="job"} 1.5778368e+09`,
+		`kube_imagepulljob_status_succeeded{namespace="ns",imagepulljob="job"} 3`,
+		`kube_imagepulljob_status_phase{namespace="ns",imagepulljob="job",phase="Running"} 1`,
+		`kube_imagepulljob_status_phase{namespace="ns",imagepulljob="job",phase="Failed"} 0`,
+		`kube_imagepulljob_info{namespace="ns",imagepulljob="job",image="nginx"} 1`,
+		`kube_imagepulljob_status_condition{namespace="ns",imagepulljob="job",type="Ready"} 1`,
+		`kube_imagepulljob_status_condition{namespace="ns",imagepulljob="job",type="Failed"} 0`,
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected output to contain %s, got:\n%s", want, out.String())
+		}
+	}
+}
@@ -0,0 +1,328 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"k8s.io/kube-state-metrics/pkg/metric"
+
+	clientset "github.com/SchoIsles/kruise-state-metrics/pkg/client/clientset/versioned"
+	kruiseappsv1alpha1 "github.com/openkruise/kruise-api/apps/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+var (
+	descDaemonSetAnnotationsName     = "kube_kruise_daemonset_annotations"
+	descDaemonSetAnnotationsHelp     = "Kubernetes annotations converted to Prometheus labels."
+	descDaemonSetLabelsName          = "kube_kruise_daemonset_labels"
+	descDaemonSetLabelsHelp          = "Kubernetes labels converted to Prometheus labels."
+	descDaemonSetLabelsDefaultLabels = []string{"namespace", "daemonset"}
+)
+
+func daemonSetMetricFamilies(allowAnnotationsList, allowLabelsList []string) []metric.FamilyGenerator {
+	return []metric.FamilyGenerator{
+		{
+			Name: "kube_kruise_daemonset_created",
+			Type: metric.Gauge,
+			Help: "Unix creation timestamp",
+			GenerateFunc: wrapDaemonSetFunc(func(d *kruiseappsv1alpha1.DaemonSet) *metric.Family {
+				ms := []*metric.Metric{}
+
+				if !d.CreationTimestamp.IsZero() {
+					ms = append(ms, &metric.Metric{
+						Value: float64(d.CreationTimestamp.Unix()),
+					})
+				}
+
+				return &metric.Family{
+					Metrics: ms,
+				}
+			}),
+		},
+		{
+			Name: "kube_kruise_daemonset_status_current_number_scheduled",
+			Type: metric.Gauge,
+			Help: "The number of nodes running at least one daemon pod and are supposed to.",
+			GenerateFunc: wrapDaemonSetFunc(func(d *kruiseappsv1alpha1.DaemonSet) *metric.Family {
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							Value: float64(d.Status.CurrentNumberScheduled),
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: "kube_kruise_daemonset_status_desired_number_scheduled",
+			Type: metric.Gauge,
+			Help: "The number of nodes that should be running the daemon pod.",
+			GenerateFunc: wrapDaemonSetFunc(func(d *kruiseappsv1alpha1.DaemonSet) *metric.Family {
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							Value: float64(d.Status.DesiredNumberScheduled),
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: "kube_kruise_daemonset_status_number_available",
+			Type: metric.Gauge,
+			Help: "The number of nodes that should be running the daemon pod and have one or more of the daemon pod running and available",
+			GenerateFunc: wrapDaemonSetFunc(func(d *kruiseappsv1alpha1.DaemonSet) *metric.Family {
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							Value: float64(d.Status.NumberAvailable),
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: "kube_kruise_daemonset_status_number_misscheduled",
+			Type: metric.Gauge,
+			Help: "The number of nodes running a daemon pod but are not supposed to.",
+			GenerateFunc: wrapDaemonSetFunc(func(d *kruiseappsv1alpha1.DaemonSet) *metric.Family {
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							Value: float64(d.Status.NumberMisscheduled),
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: "kube_kruise_daemonset_status_number_ready",
+			Type: metric.Gauge,
+			Help: "The number of nodes that should be running the daemon pod and have one or more of the daemon pod running and ready.",
+			GenerateFunc: wrapDaemonSetFunc(func(d *kruiseappsv1alpha1.DaemonSet) *metric.Family {
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							Value: float64(d.Status.NumberReady),
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: "kube_kruise_daemonset_status_number_unavailable",
+			Type: metric.Gauge,
+			Help: "The number of nodes that should be running the daemon pod and have none of the daemon pod running and available",
+			GenerateFunc: wrapDaemonSetFunc(func(d *kruiseappsv1alpha1.DaemonSet) *metric.Family {
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							Value: float64(d.Status.NumberUnavailable),
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: "kube_kruise_daemonset_updated_number_scheduled",
+			Type: metric.Gauge,
+			Help: "The total number of nodes that are running updated daemon pod",
+			GenerateFunc: wrapDaemonSetFunc(func(d *kruiseappsv1alpha1.DaemonSet) *metric.Family {
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							Value: float64(d.Status.UpdatedNumberScheduled),
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: "kube_kruise_daemonset_status_observed_generation",
+			Type: metric.Gauge,
+			Help: "The most recent generation observed by the advanced daemonset controller.",
+			GenerateFunc: wrapDaemonSetFunc(func(d *kruiseappsv1alpha1.DaemonSet) *metric.Family {
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							Value: float64(d.Status.ObservedGeneration),
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: "kube_kruise_daemonset_spec_strategy_rollingupdate_type",
+			Type: metric.Gauge,
+			Help: "The rolling update type of an advanced daemonset.",
+			GenerateFunc: wrapDaemonSetFunc(func(d *kruiseappsv1alpha1.DaemonSet) *metric.Family {
+				if d.Spec.UpdateStrategy.RollingUpdate == nil {
+					return &metric.Family{}
+				}
+
+				// An unset type is defaulted to Standard by the API server.
+				rollingUpdateType := d.Spec.UpdateStrategy.RollingUpdate.Type
+				if rollingUpdateType == "" {
+					rollingUpdateType = kruiseappsv1alpha1.StandardRollingUpdateType
+				}
+
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							LabelKeys:   []string{"type"},
+							LabelValues: []string{string(rollingUpdateType)},
+							Value:       1,
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: "kube_kruise_daemonset_spec_strategy_rollingupdate_partition",
+			Type: metric.Gauge,
+			Help: "The number of nodes that keep the old revision of an advanced daemonset during a rolling update.",
+			GenerateFunc: wrapDaemonSetFunc(func(d *kruiseappsv1alpha1.DaemonSet) *metric.Family {
+				if d.Spec.UpdateStrategy.RollingUpdate == nil || d.Spec.UpdateStrategy.RollingUpdate.Partition == nil {
+					return &metric.Family{}
+				}
+
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							Value: float64(*d.Spec.UpdateStrategy.RollingUpdate.Partition),
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: "kube_kruise_daemonset_spec_strategy_rollingupdate_selector",
+			Type: metric.Gauge,
+			Help: "The node selector restricting which nodes are updated during a rolling update of an advanced daemonset.",
+			GenerateFunc: wrapDaemonSetFunc(func(d *kruiseappsv1alpha1.DaemonSet) *metric.Family {
+				if d.Spec.UpdateStrategy.RollingUpdate == nil || d.Spec.UpdateStrategy.RollingUpdate.Selector == nil {
+					return &metric.Family{}
+				}
+
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							LabelKeys:   []string{"selector"},
+							LabelValues: []string{metav1.FormatLabelSelector(d.Spec.UpdateStrategy.RollingUpdate.Selector)},
+							Value:       1,
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: "kube_kruise_daemonset_spec_paused",
+			Type: metric.Gauge,
+			Help: "Whether the rolling update of an advanced daemonset is paused.",
+			GenerateFunc: wrapDaemonSetFunc(func(d *kruiseappsv1alpha1.DaemonSet) *metric.Family {
+				paused := false
+				if d.Spec.UpdateStrategy.RollingUpdate != nil && d.Spec.UpdateStrategy.RollingUpdate.Paused != nil {
+					paused = *d.Spec.UpdateStrategy.RollingUpdate.Paused
+				}
+
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							Value: boolFloat64(paused),
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: "kube_kruise_daemonset_metadata_generation",
+			Type: metric.Gauge,
+			Help: "Sequence number representing a specific generation of the desired state.",
+			GenerateFunc: wrapDaemonSetFunc(func(d *kruiseappsv1alpha1.DaemonSet) *metric.Family {
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							Value: float64(d.ObjectMeta.Generation),
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: descDaemonSetAnnotationsName,
+			Type: metric.Gauge,
+			Help: descDaemonSetAnnotationsHelp,
+			GenerateFunc: wrapDaemonSetFunc(func(d *kruiseappsv1alpha1.DaemonSet) *metric.Family {
+				annotationKeys, annotationValues := createPrometheusLabelKeysValues("annotation", d.Annotations, allowAnnotationsList)
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							LabelKeys:   annotationKeys,
+							LabelValues: annotationValues,
+							Value:       1,
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: descDaemonSetLabelsName,
+			Type: metric.Gauge,
+			Help: descDaemonSetLabelsHelp,
+			GenerateFunc: wrapDaemonSetFunc(func(d *kruiseappsv1alpha1.DaemonSet) *metric.Family {
+				labelKeys, labelValues := createPrometheusLabelKeysValues("label", d.Labels, allowLabelsList)
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							LabelKeys:   labelKeys,
+							LabelValues: labelValues,
+							Value:       1,
+						},
+					},
+				}
+			}),
+		},
+	}
+}
+
+func wrapDaemonSetFunc(f func(*kruiseappsv1alpha1.DaemonSet) *metric.Family) func(interface{}) *metric.Family {
+	return func(obj interface{}) *metric.Family {
+		daemonSet := obj.(*kruiseappsv1alpha1.DaemonSet)
+
+		metricFamily := f(daemonSet)
+
+		for _, m := range metricFamily.Metrics {
+			m.LabelKeys = append(descDaemonSetLabelsDefaultLabels, m.LabelKeys...)
+			m.LabelValues = append([]string{daemonSet.Namespace, daemonSet.Name}, m.LabelValues...)
+		}
+
+		return metricFamily
+	}
+}
+
+func createDaemonSetListWatch(kubeClient clientset.Interface, ns string) cache.ListerWatcher {
+	return &cache.ListWatch{
+		ListFunc: func(opts metav1.ListOptions) (runtime.Object, error) {
+			return kubeClient.AppsV1alpha1().DaemonSets(ns).List(opts)
+		},
+		WatchFunc: func(opts metav1.ListOptions) (watch.Interface, error) {
+			return kubeClient.AppsV1alpha1().DaemonSets(ns).Watch(opts)
+		},
+	}
+}
@@ -0,0 +1,222 @@
+/*
+Copyright 2018 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"reflect"
+	"strings"
+
+	kruiseappsv1alpha1 "github.com/openkruise/kruise-api/apps/v1alpha1"
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/klog"
+)
+
+// coreResources are the collectors of core Kubernetes resources, which are
+// always served and therefore never skipped by discovery.
+var coreResources = map[string]struct{}{
+	"controllerrevisions": {},
+	"pods":                {},
+}
+
+// Discovery is the result of an API discovery for a Builder: the resources
+// served in each group version its collectors need, or the error
+// discovering a group version.
+type Discovery struct {
+	served map[string]map[string]struct{}
+	errs   map[string]error
+}
+
+// err returns the first error of the discovery, if any.
+func (d *Discovery) err() error {
+	if err := d.errs[kruiseappsv1alpha1.GroupVersion.String()]; err != nil {
+		return err
+	}
+	for gv, err := range d.errs {
+		return errors.Wrapf(err, "discover %s", gv)
+	}
+	return nil
+}
+
+// Discover queries the API server for the apps.kruise.io/v1alpha1 resources
+// and those of the configured custom resources. It talks to the API server
+// and must therefore not be called while holding locks readers of the
+// stores need.
+func (b *Builder) Discover() *Discovery {
+	kruiseGV := kruiseappsv1alpha1.GroupVersion.String()
+	groupVersions := []string{kruiseGV}
+	b.discoveryMtx.RLock()
+	for _, cr := range b.customResources {
+		groupVersions = append(groupVersions, cr.gvr.GroupVersion().String())
+	}
+	client := b.discoveryClient
+	b.discoveryMtx.RUnlock()
+	if client == nil {
+		client = b.kubeClient.Discovery()
+	}
+
+	d := &Discovery{served: map[string]map[string]struct{}{}, errs: map[string]error{}}
+	for _, gv := range groupVersions {
+		if _, ok := d.served[gv]; ok {
+			continue
+		}
+		if _, ok := d.errs[gv]; ok {
+			continue
+		}
+
+		list, err := client.ServerResourcesForGroupVersion(gv)
+		if apierrors.IsNotFound(err) {
+			// The whole group version is missing, e.g. Kruise is not
+			// installed at all.
+			err = nil
+		}
+		if err != nil {
+			d.errs[gv] = err
+			continue
+		}
+
+		served := map[string]struct{}{}
+		if list != nil {
+			for _, r := range list.APIResources {
+				served[r.Name] = struct{}{}
+			}
+		}
+		d.served[gv] = served
+	}
+
+	b.setDiscoveryError(d.errs[kruiseGV])
+	return d
+}
+
+// resolveActiveResources returns the collectors to build given a discovery:
+// the enabled collectors whose resource is served, every force-enabled
+// collector and the served custom resources. Collectors of group versions
+// whose discovery failed are all returned. If report is set, skipped
+// collectors are logged and reported by the skipped collectors metric.
+func (b *Builder) resolveActiveResources(d *Discovery, report bool) []string {
+	kruiseGV := kruiseappsv1alpha1.GroupVersion.String()
+
+	var active, skipped []string
+	if err := d.errs[kruiseGV]; err != nil {
+		if report {
+			klog.Warningf("Failed to discover %s resources, enabling all collectors: %v", kruiseGV, err)
+		}
+		active, skipped = append([]string{}, b.enabledResources...), []string{}
+	} else {
+		active, skipped = b.filterServedResources(d.served[kruiseGV])
+		if report {
+			for _, c := range active {
+				if _, ok := d.served[kruiseGV][c]; !ok {
+					if _, ok := coreResources[c]; !ok {
+						klog.Warningf("Collector %s is force-enabled although its resource is not served by %s", c, kruiseGV)
+					}
+				}
+			}
+		}
+	}
+
+	customSkipped := []string{}
+	for _, cr := range b.customResources {
+		gv := cr.gvr.GroupVersion().String()
+		if err := d.errs[gv]; err != nil {
+			if report {
+				klog.Warningf("Failed to discover %s, enabling custom resource %s: %v", gv, cr.Name, err)
+			}
+			active = append(active, cr.Name)
+			continue
+		}
+		if _, ok := d.served[gv][cr.Resource]; ok {
+			active = append(active, cr.Name)
+		} else {
+			customSkipped = append(customSkipped, cr.Name)
+		}
+	}
+
+	if report {
+		for _, c := range active {
+			b.setCollectorSkipped(c, false)
+		}
+		for _, c := range append(skipped, customSkipped...) {
+			b.setCollectorSkipped(c, true)
+		}
+		if len(skipped) > 0 {
+			klog.Warningf("Skipping collectors whose resource is not served by %s: %s", kruiseGV, strings.Join(skipped, ","))
+		}
+		if len(customSkipped) > 0 {
+			klog.Warningf("Skipping custom resources that are not served: %s", strings.Join(customSkipped, ","))
+		}
+	}
+
+	return active
+}
+
+// filterServedResources splits the enabled collectors into the ones to build
+// and the ones to skip, given the set of served resources.
+func (b *Builder) filterServedResources(served map[string]struct{}) (active, skipped []string) {
+	active = []string{}
+	skipped = []string{}
+	for _, c := range b.enabledResources {
+		_, isServed := served[c]
+		if _, ok := coreResources[c]; ok {
+			isServed = true
+		}
+		_, isForced := b.forceEnabledResources[c]
+
+		switch {
+		case isServed:
+			active = append(active, c)
+		case isForced:
+			active = append(active, c)
+		default:
+			skipped = append(skipped, c)
+		}
+	}
+	return active, skipped
+}
+
+func (b *Builder) setCollectorSkipped(collector string, skipped bool) {
+	if b.skippedCollectors == nil {
+		return
+	}
+	b.skippedCollectors.WithLabelValues(collector).Set(boolFloat64(skipped))
+}
+
+// ActiveResourcesChanged reports whether the set of collectors that would be
+// built with the given discovery differs from the one of the last Build. A
+// failed discovery is never reported as change, so that an unreachable API
+// server does not cause rebuilds.
+func (b *Builder) ActiveResourcesChanged(d *Discovery) bool {
+	if err := d.err(); err != nil {
+		klog.Warningf("Failed to discover resources of cluster %q: %v", b.cluster, err)
+		return false
+	}
+	return !reflect.DeepEqual(b.resolveActiveResources(d, false), b.activeResources)
+}
+
+func (b *Builder) setDiscoveryError(err error) {
+	b.discoveryMtx.Lock()
+	defer b.discoveryMtx.Unlock()
+	b.discoveryErr = err
+}
+
+// DiscoveryError returns the error of the last API discovery, which is nil if
+// the API server was reachable.
+func (b *Builder) DiscoveryError() error {
+	b.discoveryMtx.RLock()
+	defer b.discoveryMtx.RUnlock()
+	return b.discoveryErr
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2018 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"strings"
+)
+
+// OpenMetrics family types that differ from the classic text format.
+const (
+	OpenMetricsInfo     = "info"
+	OpenMetricsStateSet = "stateset"
+	OpenMetricsUnknown  = "unknown"
+)
+
+// OpenMetricsFamily describes how a metric family is exposed in the
+// OpenMetrics format.
+type OpenMetricsFamily struct {
+	// Type is the OpenMetrics type of the family.
+	Type string
+	// StateLabel is the label holding the state of a stateset family. It is
+	// renamed to the family name, as required by OpenMetrics.
+	StateLabel string
+}
+
+// stateSetFamilies lists the one-hot families whose state label is not
+// "status".
+var stateSetFamilies = map[string]string{
+	"kube_broadcastjob_status_phase":   "phase",
+	"kube_cloneset_spec_strategy_type": "type",
+
+	"kube_kruise_pod_status_inplace_update_ready": "status",
+}
+
+// OpenMetricsFamilyFor returns how the named family has to be exposed in the
+// OpenMetrics format. It returns false for families that are exposed as-is.
+func OpenMetricsFamilyFor(name string) (OpenMetricsFamily, bool) {
+	if label, ok := stateSetFamilies[name]; ok {
+		return OpenMetricsFamily{Type: OpenMetricsStateSet, StateLabel: label}, true
+	}
+
+	switch {
+	case strings.HasSuffix(name, "_status_condition"):
+		return OpenMetricsFamily{Type: OpenMetricsStateSet, StateLabel: "status"}, true
+	case strings.HasSuffix(name, "_labels"), strings.HasSuffix(name, "_annotations"):
+		return OpenMetricsFamily{Type: OpenMetricsInfo}, true
+	case strings.HasSuffix(name, "_created"):
+		// OpenMetrics reserves the _created suffix for the creation time of
+		// counters, summaries and histograms. Expose the creation timestamp
+		// gauges as unknown so they are not mistaken for one.
+		return OpenMetricsFamily{Type: OpenMetricsUnknown}, true
+	}
+	return OpenMetricsFamily{}, false
+}
+
+// OpenMetricsFamilyFor is like the package level OpenMetricsFamilyFor, but
+// also knows the families of the custom resources of the last Build.
+func (b *Builder) OpenMetricsFamilyFor(name string) (OpenMetricsFamily, bool) {
+	if f, ok := b.openMetricsFamilies[name]; ok {
+		return f, true
+	}
+	return OpenMetricsFamilyFor(name)
+}
@@ -0,0 +1,67 @@
+/*
+Copyright 2018 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	kruiseappsv1alpha1 "github.com/openkruise/kruise-api/apps/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// kruiseOwner returns the owner reference of obj that points to a Kruise
+// workload, preferring the controller reference.
+func kruiseOwner(obj metav1.Object) *metav1.OwnerReference {
+	refs := obj.GetOwnerReferences()
+
+	var owner *metav1.OwnerReference
+	for i := range refs {
+		ref := &refs[i]
+		gv, err := schema.ParseGroupVersion(ref.APIVersion)
+		if err != nil || gv.Group != kruiseappsv1alpha1.GroupVersion.Group {
+			continue
+		}
+		if ref.Controller != nil && *ref.Controller {
+			return ref
+		}
+		if owner == nil {
+			owner = ref
+		}
+	}
+	return owner
+}
+
+// watchKruiseOwned only passes on watch events of objects owned by a Kruise
+// workload. Objects that lose their Kruise owner are reported as deleted.
+func watchKruiseOwned(w watch.Interface, err error) (watch.Interface, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	return watch.Filter(w, func(e watch.Event) (watch.Event, bool) {
+		obj, err := meta.Accessor(e.Object)
+		if err != nil || kruiseOwner(obj) != nil {
+			return e, true
+		}
+		if e.Type == watch.Modified {
+			e.Type = watch.Deleted
+			return e, true
+		}
+		return e, e.Type == watch.Deleted
+	}), nil
+}
@@ -0,0 +1,417 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"encoding/json"
+	"sync"
+
+	"k8s.io/kube-state-metrics/pkg/metric"
+
+	kruiseappsv1alpha1 "github.com/openkruise/kruise-api/apps/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+var (
+	descPodAnnotationsName     = "kube_kruise_pod_annotations"
+	descPodAnnotationsHelp     = "Kubernetes annotations converted to Prometheus labels."
+	descPodLabelsName          = "kube_kruise_pod_labels"
+	descPodLabelsHelp          = "Kubernetes labels converted to Prometheus labels."
+	descPodLabelsDefaultLabels = []string{"namespace", "pod"}
+)
+
+func podMetricFamilies(allowAnnotationsList, allowLabelsList []string) []metric.FamilyGenerator {
+	inPlaceUpdateStates := &inPlaceUpdateStateCache{}
+
+	return []metric.FamilyGenerator{
+		{
+			Name: "kube_kruise_pod_created",
+			Type: metric.Gauge,
+			Help: "Unix creation timestamp",
+			GenerateFunc: wrapPodFunc(func(p *v1.Pod) *metric.Family {
+				ms := []*metric.Metric{}
+
+				if !p.CreationTimestamp.IsZero() {
+					ms = append(ms, &metric.Metric{
+						Value: float64(p.CreationTimestamp.Unix()),
+					})
+				}
+
+				return &metric.Family{
+					Metrics: ms,
+				}
+			}),
+		},
+		{
+			Name: "kube_kruise_pod_owner",
+			Type: metric.Gauge,
+			Help: "Information about the Kruise workload owning the pod.",
+			GenerateFunc: wrapPodFunc(func(p *v1.Pod) *metric.Family {
+				owner := kruiseOwner(p)
+				if owner == nil {
+					return &metric.Family{}
+				}
+
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							LabelKeys:   []string{"owner_kind", "owner_name"},
+							LabelValues: []string{owner.Kind, owner.Name},
+							Value:       1,
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: "kube_kruise_pod_controller_revision_hash",
+			Type: metric.Gauge,
+			Help: "The controller revision the pod was created from.",
+			GenerateFunc: wrapPodFunc(func(p *v1.Pod) *metric.Family {
+				revision, ok := p.Labels[appsv1.ControllerRevisionHashLabelKey]
+				if !ok {
+					return &metric.Family{}
+				}
+
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							LabelKeys:   []string{"revision"},
+							LabelValues: []string{revision},
+							Value:       1,
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: "kube_kruise_pod_status_inplace_update_ready",
+			Type: metric.Gauge,
+			Help: "Describes whether the InPlaceUpdateReady readiness gate of the pod is met.",
+			GenerateFunc: wrapPodFunc(func(p *v1.Pod) *metric.Family {
+				ms := []*metric.Metric{}
+
+				if c := inPlaceUpdateReadyCondition(p); c != nil {
+					for _, m := range addConditionMetrics(c.Status) {
+						metric := m
+						metric.LabelKeys = []string{"status"}
+						ms = append(ms, metric)
+					}
+				}
+
+				return &metric.Family{
+					Metrics: ms,
+				}
+			}),
+		},
+		{
+			Name: "kube_kruise_pod_inplace_update_revision",
+			Type: metric.Gauge,
+			Help: "The revision of the last in-place update of the pod.",
+			GenerateFunc: wrapPodFunc(func(p *v1.Pod) *metric.Family {
+				state, err := inPlaceUpdateStates.get(p)
+				if err != nil {
+					return generateError("kube_kruise_pod_inplace_update_revision", p, err)
+				}
+				if state == nil {
+					return &metric.Family{}
+				}
+
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							LabelKeys:   []string{"revision"},
+							LabelValues: []string{state.Revision},
+							Value:       1,
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: "kube_kruise_pod_inplace_update_timestamp_seconds",
+			Type: metric.Gauge,
+			Help: "Unix timestamp of the last in-place update of the pod.",
+			GenerateFunc: wrapPodFunc(func(p *v1.Pod) *metric.Family {
+				state, err := inPlaceUpdateStates.get(p)
+				if err != nil {
+					return generateError("kube_kruise_pod_inplace_update_timestamp_seconds", p, err)
+				}
+				if state == nil || state.UpdateTimestamp.IsZero() {
+					return &metric.Family{}
+				}
+
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							Value: float64(state.UpdateTimestamp.Unix()),
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: "kube_kruise_pod_inplace_update_containers",
+			Type: metric.Gauge,
+			Help: "Number of containers changed by the last in-place update of the pod.",
+			GenerateFunc: wrapPodFunc(func(p *v1.Pod) *metric.Family {
+				state, err := inPlaceUpdateStates.get(p)
+				if err != nil {
+					return generateError("kube_kruise_pod_inplace_update_containers", p, err)
+				}
+				if state == nil {
+					return &metric.Family{}
+				}
+
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							Value: float64(len(state.LastContainerStatuses)),
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: "kube_kruise_pod_inplace_update_containers_updated",
+			Type: metric.Gauge,
+			Help: "Number of containers changed by the last in-place update of the pod that already run the new image.",
+			GenerateFunc: wrapPodFunc(func(p *v1.Pod) *metric.Family {
+				state, err := inPlaceUpdateStates.get(p)
+				if err != nil {
+					return generateError("kube_kruise_pod_inplace_update_containers_updated", p, err)
+				}
+				if state == nil {
+					return &metric.Family{}
+				}
+
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							Value: float64(inPlaceUpdatedContainers(p, state)),
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: "kube_kruise_pod_inplace_update_completed",
+			Type: metric.Gauge,
+			Help: "Whether all containers changed by the last in-place update of the pod run the new image and its InPlaceUpdateReady readiness gate is met.",
+			GenerateFunc: wrapPodFunc(func(p *v1.Pod) *metric.Family {
+				state, err := inPlaceUpdateStates.get(p)
+				if err != nil {
+					return generateError("kube_kruise_pod_inplace_update_completed", p, err)
+				}
+				if state == nil {
+					return &metric.Family{}
+				}
+
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							Value: boolFloat64(inPlaceUpdateCompleted(p, state)),
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: "kube_kruise_pod_inplace_update_duration_seconds",
+			Type: metric.Gauge,
+			Help: "Seconds the last completed in-place update of the pod took until its InPlaceUpdateReady readiness gate was met again.",
+			GenerateFunc: wrapPodFunc(func(p *v1.Pod) *metric.Family {
+				state, err := inPlaceUpdateStates.get(p)
+				if err != nil {
+					return generateError("kube_kruise_pod_inplace_update_duration_seconds", p, err)
+				}
+				if state == nil || state.UpdateTimestamp.IsZero() || !inPlaceUpdateCompleted(p, state) {
+					return &metric.Family{}
+				}
+
+				ready := inPlaceUpdateReadyCondition(p)
+				if ready == nil || !ready.LastTransitionTime.After(state.UpdateTimestamp.Time) {
+					return &metric.Family{}
+				}
+
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							Value: ready.LastTransitionTime.Sub(state.UpdateTimestamp.Time).Seconds(),
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: descPodAnnotationsName,
+			Type: metric.Gauge,
+			Help: descPodAnnotationsHelp,
+			GenerateFunc: wrapPodFunc(func(p *v1.Pod) *metric.Family {
+				annotationKeys, annotationValues := createPrometheusLabelKeysValues("annotation", p.Annotations, allowAnnotationsList)
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							LabelKeys:   annotationKeys,
+							LabelValues: annotationValues,
+							Value:       1,
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: descPodLabelsName,
+			Type: metric.Gauge,
+			Help: descPodLabelsHelp,
+			GenerateFunc: wrapPodFunc(func(p *v1.Pod) *metric.Family {
+				labelKeys, labelValues := createPrometheusLabelKeysValues("label", p.Labels, allowLabelsList)
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							LabelKeys:   labelKeys,
+							LabelValues: labelValues,
+							Value:       1,
+						},
+					},
+				}
+			}),
+		},
+	}
+}
+
+// inPlaceUpdateStateCache holds the in-place update state of the last pod
+// metrics were generated for. The families of an object are generated one
+// after the other, so the annotation is decoded once per generate pass
+// instead of once per family.
+type inPlaceUpdateStateCache struct {
+	mtx   sync.Mutex
+	pod   *v1.Pod
+	state *kruiseappsv1alpha1.InPlaceUpdateState
+	err   error
+}
+
+// get returns the in-place update state of the pod, decoding it if the pod
+// differs from the last one. A decoding error is only returned to the first
+// family asking for it, so a malformed annotation counts as a single
+// generation error per pod update; the other families are empty.
+func (c *inPlaceUpdateStateCache) get(p *v1.Pod) (*kruiseappsv1alpha1.InPlaceUpdateState, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if c.pod != p {
+		c.pod = p
+		c.state, c.err = inPlaceUpdateState(p)
+		return c.state, c.err
+	}
+	return c.state, nil
+}
+
+// inPlaceUpdateState decodes the in-place update state Kruise records on the
+// pod. It returns nil if the pod has never been updated in-place.
+func inPlaceUpdateState(p *v1.Pod) (*kruiseappsv1alpha1.InPlaceUpdateState, error) {
+	raw, ok := p.Annotations[kruiseappsv1alpha1.InPlaceUpdateStateKey]
+	if !ok || raw == "" {
+		return nil, nil
+	}
+
+	state := &kruiseappsv1alpha1.InPlaceUpdateState{}
+	if err := json.Unmarshal([]byte(raw), state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// inPlaceUpdatedContainers counts the containers of the in-place update state
+// whose running image differs from the one recorded before the update.
+func inPlaceUpdatedContainers(p *v1.Pod, state *kruiseappsv1alpha1.InPlaceUpdateState) int {
+	updated := 0
+	for _, cs := range p.Status.ContainerStatuses {
+		last, ok := state.LastContainerStatuses[cs.Name]
+		if ok && cs.ImageID != "" && cs.ImageID != last.ImageID {
+			updated++
+		}
+	}
+	return updated
+}
+
+// inPlaceUpdateReadyCondition returns the InPlaceUpdateReady condition of the
+// pod, or nil if the pod has none.
+func inPlaceUpdateReadyCondition(p *v1.Pod) *v1.PodCondition {
+	for i := range p.Status.Conditions {
+		if p.Status.Conditions[i].Type == kruiseappsv1alpha1.InPlaceUpdateReady {
+			return &p.Status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// inPlaceUpdateCompleted reports whether every container changed by the
+// in-place update runs the new image and the readiness gate is met again.
+func inPlaceUpdateCompleted(p *v1.Pod, state *kruiseappsv1alpha1.InPlaceUpdateState) bool {
+	if inPlaceUpdatedContainers(p, state) < len(state.LastContainerStatuses) {
+		return false
+	}
+	c := inPlaceUpdateReadyCondition(p)
+	return c != nil && c.Status == v1.ConditionTrue
+}
+
+func wrapPodFunc(f func(*v1.Pod) *metric.Family) func(interface{}) *metric.Family {
+	return func(obj interface{}) *metric.Family {
+		pod := obj.(*v1.Pod)
+
+		metricFamily := f(pod)
+
+		for _, m := range metricFamily.Metrics {
+			m.LabelKeys = append(descPodLabelsDefaultLabels, m.LabelKeys...)
+			m.LabelValues = append([]string{pod.Namespace, pod.Name}, m.LabelValues...)
+		}
+
+		return metricFamily
+	}
+}
+
+// createPodListWatch lists and watches the pods of the given namespace, but
+// only passes on pods owned by a Kruise workload.
+func createPodListWatch(kubeClient kubernetes.Interface, ns string) cache.ListerWatcher {
+	return &cache.ListWatch{
+		ListFunc: func(opts metav1.ListOptions) (runtime.Object, error) {
+			list, err := kubeClient.CoreV1().Pods(ns).List(opts)
+			if err != nil {
+				return nil, err
+			}
+
+			items := list.Items[:0]
+			for _, p := range list.Items {
+				if kruiseOwner(&p) != nil {
+					items = append(items, p)
+				}
+			}
+			list.Items = items
+			return list, nil
+		},
+		WatchFunc: func(opts metav1.ListOptions) (watch.Interface, error) {
+			return watchKruiseOwned(kubeClient.CoreV1().Pods(ns).Watch(opts))
+		},
+	}
+}
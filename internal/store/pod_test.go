@@ -0,0 +1,100 @@
+/*
+Copyright 2018 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"strings"
+	"testing"
+
+	kruiseappsv1alpha1 "github.com/openkruise/kruise-api/apps/v1alpha1"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPodInPlaceUpdateState(t *testing.T) {
+	pod := func(state string) *v1.Pod {
+		return &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "ns",
+				Name:        "p",
+				Annotations: map[string]string{kruiseappsv1alpha1.InPlaceUpdateStateKey: state},
+			},
+			Status: v1.PodStatus{
+				ContainerStatuses: []v1.ContainerStatus{{Name: "app", ImageID: "new"}},
+			},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		pods       []*v1.Pod
+		wantErrors float64
+		want       []string
+	}{
+		{
+			name: "valid",
+			pods: []*v1.Pod{pod(`{"revision":"r2","updateTimestamp":"2020-01-01T00:00:00Z","lastContainerStatuses":{"app":{"imageID":"old"}}}`)},
+			want: []string{
+				`kube_kruise_pod_inplace_update_revision{namespace="ns",pod="p",revision="r2"} 1`,
+				`kube_kruise_pod_inplace_update_timestamp_seconds{namespace="ns",pod="p"} 1.5778368e+09`,
+				`kube_kruise_pod_inplace_update_containers{namespace="ns",pod="p"} 1`,
+				`kube_kruise_pod_inplace_update_containers_updated{namespace="ns",pod="p"} 1`,
+			},
+		},
+		{
+			name:       "malformed",
+			pods:       []*v1.Pod{pod(`{`)},
+			wantErrors: 1,
+		},
+		{
+			name:       "malformed in two updates",
+			pods:       []*v1.Pod{pod(`{`), pod(`{`)},
+			wantErrors: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			families := podMetricFamilies(nil, nil)
+			errorsBefore := 0.0
+			for _, f := range families {
+				errorsBefore += testutil.ToFloat64(generateErrorsTotal.WithLabelValues(f.Name))
+			}
+
+			var out strings.Builder
+			for _, p := range tt.pods {
+				for _, f := range families {
+					out.Write(f.Generate(p).ByteSlice())
+				}
+			}
+
+			errors := -errorsBefore
+			for _, f := range families {
+				errors += testutil.ToFloat64(generateErrorsTotal.WithLabelValues(f.Name))
+			}
+			if errors != tt.wantErrors {
+				t.Errorf("expected %v generation errors, got %v", tt.wantErrors, errors)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("expected output to contain %s, got:\n%s", want, out.String())
+				}
+			}
+		})
+	}
+}
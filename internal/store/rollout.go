@@ -0,0 +1,331 @@
+/*
+Copyright 2018 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"io"
+	"reflect"
+	"sync"
+	"time"
+
+	kruiseappsv1alpha1 "github.com/openkruise/kruise-api/apps/v1alpha1"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog"
+)
+
+var rolloutLabels = []string{"kind", "namespace", "workload"}
+
+// Metric families of the rollout tracker.
+const (
+	rolloutDurationFamily       = "kruise_rollout_duration_seconds"
+	lastRolloutStartFamily      = "kruise_last_rollout_start_timestamp_seconds"
+	lastRolloutCompletionFamily = "kruise_last_rollout_completion_timestamp_seconds"
+)
+
+// rolloutFamilies are the metric families of the rollout tracker.
+var rolloutFamilies = []string{rolloutDurationFamily, lastRolloutStartFamily, lastRolloutCompletionFamily}
+
+// rolloutStatus is the part of a workload's state the rollout tracker needs.
+type rolloutStatus struct {
+	kind      string
+	uid       types.UID
+	namespace string
+	name      string
+	revision  string
+	complete  bool
+}
+
+// rolloutSource describes a workload type whose rollouts are tracked.
+type rolloutSource struct {
+	kind      string
+	collector string
+	status    func(obj interface{}) rolloutStatus
+}
+
+// rolloutSources maps the type of every workload whose rollouts are tracked
+// to its source.
+var rolloutSources = map[reflect.Type]rolloutSource{
+	reflect.TypeOf(&kruiseappsv1alpha1.CloneSet{}): {
+		kind:      "CloneSet",
+		collector: "clonesets",
+		status: func(obj interface{}) rolloutStatus {
+			c := obj.(*kruiseappsv1alpha1.CloneSet)
+			return rolloutStatus{
+				kind:      "CloneSet",
+				uid:       c.UID,
+				namespace: c.Namespace,
+				name:      c.Name,
+				revision:  c.Status.UpdateRevision,
+				complete: c.Spec.Replicas != nil &&
+					c.Status.ObservedGeneration >= c.Generation &&
+					c.Status.UpdatedReadyReplicas >= *c.Spec.Replicas,
+			}
+		},
+	},
+	reflect.TypeOf(&kruiseappsv1alpha1.StatefulSet{}): {
+		kind:      "StatefulSet",
+		collector: "statefulsets",
+		status: func(obj interface{}) rolloutStatus {
+			s := obj.(*kruiseappsv1alpha1.StatefulSet)
+			return rolloutStatus{
+				kind:      "StatefulSet",
+				uid:       s.UID,
+				namespace: s.Namespace,
+				name:      s.Name,
+				revision:  s.Status.UpdateRevision,
+				complete: s.Spec.Replicas != nil &&
+					s.Status.ObservedGeneration >= s.Generation &&
+					s.Status.UpdatedReplicas >= *s.Spec.Replicas &&
+					s.Status.ReadyReplicas >= *s.Spec.Replicas,
+			}
+		},
+	},
+}
+
+type rolloutKey struct {
+	kind string
+	uid  types.UID
+}
+
+// rollout is the last observed revision of a workload and, while a rollout
+// of that revision is in progress, the time it started.
+type rollout struct {
+	namespace string
+	name      string
+	revision  string
+	start     time.Time
+}
+
+// rolloutTracker follows the update revision of workloads across reflector
+// events and measures how long it takes until a new revision is fully rolled
+// out. Rollouts already in progress when a workload is first seen are not
+// measured, as their start is unknown.
+type rolloutTracker struct {
+	mtx      sync.Mutex
+	now      func() time.Time
+	rollouts map[rolloutKey]*rollout
+
+	registry       *prometheus.Registry
+	duration       *prometheus.HistogramVec
+	lastStart      *prometheus.GaugeVec
+	lastCompletion *prometheus.GaugeVec
+}
+
+func newRolloutTracker() *rolloutTracker {
+	t := &rolloutTracker{
+		now:      time.Now,
+		rollouts: map[rolloutKey]*rollout{},
+		registry: prometheus.NewRegistry(),
+		duration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    rolloutDurationFamily,
+				Help:    "Seconds from a change of the update revision of a workload until all its desired replicas are updated and ready.",
+				Buckets: prometheus.ExponentialBuckets(15, 2, 10),
+			},
+			rolloutLabels,
+		),
+		lastStart: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: lastRolloutStartFamily,
+				Help: "Unix timestamp of the last observed change of the update revision of a workload.",
+			},
+			rolloutLabels,
+		),
+		lastCompletion: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: lastRolloutCompletionFamily,
+				Help: "Unix timestamp at which the last measured rollout of a workload completed.",
+			},
+			rolloutLabels,
+		),
+	}
+	t.registry.MustRegister(t.duration, t.lastStart, t.lastCompletion)
+	return t
+}
+
+// wrapStore returns a store that feeds the tracker with every change applied
+// to store, or store itself if rollouts of expectedType are not tracked.
+func (t *rolloutTracker) wrapStore(expectedType interface{}, store cache.Store) cache.Store {
+	source, ok := rolloutSources[reflect.TypeOf(expectedType)]
+	if !ok {
+		return store
+	}
+	return &rolloutStore{Store: store, tracker: t, kind: source.kind, status: source.status}
+}
+
+func (t *rolloutTracker) observe(s rolloutStatus) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	key := rolloutKey{kind: s.kind, uid: s.uid}
+	r, ok := t.rollouts[key]
+	if !ok {
+		t.rollouts[key] = &rollout{namespace: s.namespace, name: s.name, revision: s.revision}
+		return
+	}
+
+	labels := []string{s.kind, s.namespace, s.name}
+	now := t.now()
+
+	if s.revision != r.revision {
+		r.revision = s.revision
+		r.start = now
+		t.lastStart.WithLabelValues(labels...).Set(float64(now.Unix()))
+	}
+
+	if !r.start.IsZero() && s.complete {
+		t.duration.WithLabelValues(labels...).Observe(now.Sub(r.start).Seconds())
+		t.lastCompletion.WithLabelValues(labels...).Set(float64(now.Unix()))
+		r.start = time.Time{}
+	}
+}
+
+func (t *rolloutTracker) forget(s rolloutStatus) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	t.forgetLocked(rolloutKey{kind: s.kind, uid: s.uid})
+}
+
+func (t *rolloutTracker) forgetLocked(key rolloutKey) {
+	r, ok := t.rollouts[key]
+	if !ok {
+		return
+	}
+	delete(t.rollouts, key)
+
+	labels := []string{key.kind, r.namespace, r.name}
+	t.duration.DeleteLabelValues(labels...)
+	t.lastStart.DeleteLabelValues(labels...)
+	t.lastCompletion.DeleteLabelValues(labels...)
+}
+
+// forgetKind forgets every workload of the given kind.
+func (t *rolloutTracker) forgetKind(kind string) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	for key := range t.rollouts {
+		if key.kind == kind {
+			t.forgetLocked(key)
+		}
+	}
+}
+
+// replace observes every workload of a relist and forgets the workloads of
+// the same kind that are no longer part of it.
+func (t *rolloutTracker) replace(kind string, statuses []rolloutStatus) {
+	for _, s := range statuses {
+		t.observe(s)
+	}
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	listed := make(map[rolloutKey]struct{}, len(statuses))
+	for _, s := range statuses {
+		listed[rolloutKey{kind: s.kind, uid: s.uid}] = struct{}{}
+	}
+	for key := range t.rollouts {
+		if _, ok := listed[key]; !ok && key.kind == kind {
+			t.forgetLocked(key)
+		}
+	}
+}
+
+// writeAll writes the rollout metrics of the workloads of the given kinds in
+// the Prometheus text format, leaving out the families not included by l.
+func (t *rolloutTracker) writeAll(w io.Writer, l whiteBlackLister, kinds map[string]struct{}) {
+	families, err := t.registry.Gather()
+	if err != nil {
+		klog.Errorf("Failed to gather rollout metrics: %v", err)
+		return
+	}
+	for _, mf := range families {
+		if !l.IsIncluded(mf.GetName()) {
+			continue
+		}
+
+		metrics := mf.Metric[:0]
+		for _, m := range mf.Metric {
+			for _, label := range m.Label {
+				if _, ok := kinds[label.GetValue()]; ok && label.GetName() == "kind" {
+					metrics = append(metrics, m)
+					break
+				}
+			}
+		}
+		if len(metrics) == 0 {
+			continue
+		}
+		mf.Metric = metrics
+
+		if _, err := expfmt.MetricFamilyToText(w, mf); err != nil {
+			klog.Errorf("Failed to write rollout metrics: %v", err)
+			return
+		}
+	}
+}
+
+// rolloutStore is a cache.Store that passes every change on to the rollout
+// tracker after applying it to the wrapped store.
+type rolloutStore struct {
+	cache.Store
+	tracker *rolloutTracker
+	kind    string
+	status  func(obj interface{}) rolloutStatus
+}
+
+func (s *rolloutStore) Add(obj interface{}) error {
+	if err := s.Store.Add(obj); err != nil {
+		return err
+	}
+	s.tracker.observe(s.status(obj))
+	return nil
+}
+
+func (s *rolloutStore) Update(obj interface{}) error {
+	if err := s.Store.Update(obj); err != nil {
+		return err
+	}
+	s.tracker.observe(s.status(obj))
+	return nil
+}
+
+func (s *rolloutStore) Delete(obj interface{}) error {
+	if err := s.Store.Delete(obj); err != nil {
+		return err
+	}
+	s.tracker.forget(s.status(obj))
+	return nil
+}
+
+func (s *rolloutStore) Replace(list []interface{}, resourceVersion string) error {
+	if err := s.Store.Replace(list, resourceVersion); err != nil {
+		return err
+	}
+
+	statuses := make([]rolloutStatus, 0, len(list))
+	for _, obj := range list {
+		statuses = append(statuses, s.status(obj))
+	}
+	s.tracker.replace(s.kind, statuses)
+	return nil
+}
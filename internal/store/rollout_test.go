@@ -0,0 +1,228 @@
+/*
+Copyright 2018 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/kube-state-metrics/pkg/whiteblacklist"
+)
+
+// rolloutSeries returns the samples of the rollout tracker by family and
+// workload name. Histograms are reported by their sample count.
+func rolloutSeries(t *testing.T, tracker *rolloutTracker) map[string]map[string]float64 {
+	families, err := tracker.registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	series := map[string]map[string]float64{}
+	for _, mf := range families {
+		series[mf.GetName()] = map[string]float64{}
+		for _, m := range mf.Metric {
+			series[mf.GetName()][labelValue(m, "workload")] = metricValue(m)
+		}
+	}
+	return series
+}
+
+func labelValue(m *dto.Metric, name string) string {
+	for _, l := range m.Label {
+		if l.GetName() == name {
+			return l.GetValue()
+		}
+	}
+	return ""
+}
+
+func metricValue(m *dto.Metric) float64 {
+	switch {
+	case m.Histogram != nil:
+		return float64(m.Histogram.GetSampleCount())
+	case m.Gauge != nil:
+		return m.Gauge.GetValue()
+	}
+	return 0
+}
+
+func cloneSetStatus(uid, name, revision string, complete bool) rolloutStatus {
+	return rolloutStatus{kind: "CloneSet", uid: types.UID(uid), namespace: "ns", name: name, revision: revision, complete: complete}
+}
+
+func TestRolloutTracker(t *testing.T) {
+	start := time.Unix(1000, 0)
+	now := start
+	tracker := newRolloutTracker()
+	tracker.now = func() time.Time { return now }
+
+	// A workload seen for the first time is not measured.
+	tracker.observe(cloneSetStatus("1", "a", "r1", false))
+	if got := rolloutSeries(t, tracker); len(got) != 0 {
+		t.Fatalf("expected no series after first observation, got %v", got)
+	}
+
+	// A new revision starts a rollout.
+	tracker.observe(cloneSetStatus("1", "a", "r2", false))
+	got := rolloutSeries(t, tracker)
+	if v := got["kruise_last_rollout_start_timestamp_seconds"]["a"]; v != 1000 {
+		t.Errorf("expected start timestamp 1000, got %v", v)
+	}
+	if _, ok := got["kruise_rollout_duration_seconds"]; ok {
+		t.Errorf("expected no duration before completion, got %v", got["kruise_rollout_duration_seconds"])
+	}
+
+	// Completion observes the duration once.
+	now = start.Add(90 * time.Second)
+	tracker.observe(cloneSetStatus("1", "a", "r2", true))
+	tracker.observe(cloneSetStatus("1", "a", "r2", true))
+	got = rolloutSeries(t, tracker)
+	if v := got["kruise_rollout_duration_seconds"]["a"]; v != 1 {
+		t.Errorf("expected 1 duration observation, got %v", v)
+	}
+	if v := got["kruise_last_rollout_completion_timestamp_seconds"]["a"]; v != 1090 {
+		t.Errorf("expected completion timestamp 1090, got %v", v)
+	}
+
+	// Forgetting a workload deletes its series.
+	tracker.forget(cloneSetStatus("1", "a", "r2", true))
+	if got := rolloutSeries(t, tracker); len(got) != 0 {
+		t.Errorf("expected no series after forget, got %v", got)
+	}
+	if len(tracker.rollouts) != 0 {
+		t.Errorf("expected no tracked rollouts after forget, got %v", tracker.rollouts)
+	}
+}
+
+func TestRolloutTrackerReplace(t *testing.T) {
+	tracker := newRolloutTracker()
+	tracker.now = func() time.Time { return time.Unix(1000, 0) }
+
+	statefulSet := rolloutStatus{kind: "StatefulSet", uid: "3", namespace: "ns", name: "c", revision: "r1"}
+	for _, s := range []rolloutStatus{cloneSetStatus("1", "a", "r1", false), cloneSetStatus("2", "b", "r1", false), statefulSet} {
+		tracker.observe(s)
+	}
+	statefulSet.revision = "r2"
+	tracker.observe(statefulSet)
+
+	// The relist observes a new revision of a and drops b, the StatefulSet
+	// is of another kind and kept.
+	tracker.replace("CloneSet", []rolloutStatus{cloneSetStatus("1", "a", "r2", false)})
+
+	if _, ok := tracker.rollouts[rolloutKey{kind: "CloneSet", uid: "2"}]; ok {
+		t.Error("expected b to be forgotten")
+	}
+	if _, ok := tracker.rollouts[rolloutKey{kind: "StatefulSet", uid: "3"}]; !ok {
+		t.Error("expected StatefulSet c to be kept")
+	}
+	got := rolloutSeries(t, tracker)["kruise_last_rollout_start_timestamp_seconds"]
+	if _, ok := got["a"]; !ok {
+		t.Errorf("expected a rollout of a to start, got %v", got)
+	}
+	if _, ok := got["c"]; !ok {
+		t.Errorf("expected the rollout of c to be kept, got %v", got)
+	}
+
+	// An empty relist forgets every workload of the kind.
+	tracker.replace("CloneSet", nil)
+	if _, ok := rolloutSeries(t, tracker)["kruise_last_rollout_start_timestamp_seconds"]["a"]; ok {
+		t.Error("expected a to be forgotten")
+	}
+
+	tracker.forgetKind("StatefulSet")
+	if len(tracker.rollouts) != 0 {
+		t.Errorf("expected no tracked rollouts, got %v", tracker.rollouts)
+	}
+}
+
+func TestRolloutTrackerWriteAll(t *testing.T) {
+	tracker := newRolloutTracker()
+	for _, s := range []rolloutStatus{
+		cloneSetStatus("1", "a", "r1", false),
+		cloneSetStatus("1", "a", "r2", true),
+		{kind: "StatefulSet", uid: "2", namespace: "ns", name: "b", revision: "r1"},
+		{kind: "StatefulSet", uid: "2", namespace: "ns", name: "b", revision: "r2"},
+	} {
+		tracker.observe(s)
+	}
+
+	tests := []struct {
+		name      string
+		blacklist []string
+		kinds     []string
+		want      []string
+		notWant   []string
+	}{
+		{
+			name:    "all kinds",
+			kinds:   []string{"CloneSet", "StatefulSet"},
+			want:    []string{`kind="CloneSet"`, `kind="StatefulSet"`, "kruise_rollout_duration_seconds_bucket"},
+			notWant: []string{},
+		},
+		{
+			name:    "only StatefulSets",
+			kinds:   []string{"StatefulSet"},
+			want:    []string{`kind="StatefulSet"`},
+			notWant: []string{`kind="CloneSet"`, "kruise_rollout_duration_seconds"},
+		},
+		{
+			name:      "blacklisted histogram",
+			blacklist: []string{"kruise_rollout_duration_seconds"},
+			kinds:     []string{"CloneSet"},
+			want:      []string{"kruise_last_rollout_completion_timestamp_seconds"},
+			notWant:   []string{"kruise_rollout_duration_seconds"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blacklist := map[string]struct{}{}
+			for _, m := range tt.blacklist {
+				blacklist[m] = struct{}{}
+			}
+			l, err := whiteblacklist.New(map[string]struct{}{}, blacklist)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := l.Parse(); err != nil {
+				t.Fatal(err)
+			}
+			kinds := map[string]struct{}{}
+			for _, k := range tt.kinds {
+				kinds[k] = struct{}{}
+			}
+
+			var buf bytes.Buffer
+			tracker.writeAll(&buf, l, kinds)
+			out := buf.String()
+			for _, s := range tt.want {
+				if !strings.Contains(out, s) {
+					t.Errorf("expected output to contain %s, got:\n%s", s, out)
+				}
+			}
+			for _, s := range tt.notWant {
+				if strings.Contains(out, s) {
+					t.Errorf("expected output not to contain %s, got:\n%s", s, out)
+				}
+			}
+		})
+	}
+}
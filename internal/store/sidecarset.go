@@ -0,0 +1,248 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"k8s.io/kube-state-metrics/pkg/metric"
+
+	clientset "github.com/SchoIsles/kruise-state-metrics/pkg/client/clientset/versioned"
+	kruiseappsv1alpha1 "github.com/openkruise/kruise-api/apps/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+var (
+	descSidecarSetAnnotationsName     = "kube_sidecarset_annotations"
+	descSidecarSetAnnotationsHelp     = "Kubernetes annotations converted to Prometheus labels."
+	descSidecarSetLabelsName          = "kube_sidecarset_labels"
+	descSidecarSetLabelsHelp          = "Kubernetes labels converted to Prometheus labels."
+	descSidecarSetLabelsDefaultLabels = []string{"sidecarset"}
+)
+
+func sidecarSetMetricFamilies(allowAnnotationsList, allowLabelsList []string) []metric.FamilyGenerator {
+	return []metric.FamilyGenerator{
+		{
+			Name: "kube_sidecarset_created",
+			Type: metric.Gauge,
+			Help: "Unix creation timestamp",
+			GenerateFunc: wrapSidecarSetFunc(func(s *kruiseappsv1alpha1.SidecarSet) *metric.Family {
+				ms := []*metric.Metric{}
+
+				if !s.CreationTimestamp.IsZero() {
+					ms = append(ms, &metric.Metric{
+						Value: float64(s.CreationTimestamp.Unix()),
+					})
+				}
+
+				return &metric.Family{
+					Metrics: ms,
+				}
+			}),
+		},
+		{
+			Name: "kube_sidecarset_status_matched_pods",
+			Type: metric.Gauge,
+			Help: "The number of pods matched by the sidecarset.",
+			GenerateFunc: wrapSidecarSetFunc(func(s *kruiseappsv1alpha1.SidecarSet) *metric.Family {
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							Value: float64(s.Status.MatchedPods),
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: "kube_sidecarset_status_updated_pods",
+			Type: metric.Gauge,
+			Help: "The number of matched pods injected with the latest sidecarset containers.",
+			GenerateFunc: wrapSidecarSetFunc(func(s *kruiseappsv1alpha1.SidecarSet) *metric.Family {
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							Value: float64(s.Status.UpdatedPods),
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: "kube_sidecarset_status_ready_pods",
+			Type: metric.Gauge,
+			Help: "The number of matched pods that are ready.",
+			GenerateFunc: wrapSidecarSetFunc(func(s *kruiseappsv1alpha1.SidecarSet) *metric.Family {
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							Value: float64(s.Status.ReadyPods),
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: "kube_sidecarset_status_observed_generation",
+			Type: metric.Gauge,
+			Help: "The generation observed by the sidecarset controller.",
+			GenerateFunc: wrapSidecarSetFunc(func(s *kruiseappsv1alpha1.SidecarSet) *metric.Family {
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							Value: float64(s.Status.ObservedGeneration),
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: "kube_sidecarset_spec_paused",
+			Type: metric.Gauge,
+			Help: "Whether the sidecarset is paused and will not update its sidecar containers.",
+			GenerateFunc: wrapSidecarSetFunc(func(s *kruiseappsv1alpha1.SidecarSet) *metric.Family {
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							Value: boolFloat64(s.Spec.Paused),
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: "kube_sidecarset_spec_strategy_rollingupdate_max_unavailable",
+			Type: metric.Gauge,
+			Help: "Maximum number of unavailable matched pods during a rolling update of a sidecarset.",
+			GenerateFunc: wrapSidecarSetFunc(func(s *kruiseappsv1alpha1.SidecarSet) *metric.Family {
+				if s.Spec.Strategy.RollingUpdate == nil || s.Spec.Strategy.RollingUpdate.MaxUnavailable == nil {
+					return &metric.Family{}
+				}
+
+				maxUnavailable, err := intstr.GetValueFromIntOrPercent(s.Spec.Strategy.RollingUpdate.MaxUnavailable, int(s.Status.MatchedPods), false)
+				if err != nil {
+					return generateError("kube_sidecarset_spec_strategy_rollingupdate_max_unavailable", s, err)
+				}
+
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							Value: float64(maxUnavailable),
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: "kube_sidecarset_container_info",
+			Type: metric.Gauge,
+			Help: "Information about the sidecar containers injected by a sidecarset.",
+			GenerateFunc: wrapSidecarSetFunc(func(s *kruiseappsv1alpha1.SidecarSet) *metric.Family {
+				ms := make([]*metric.Metric, 0, len(s.Spec.Containers))
+
+				for _, c := range s.Spec.Containers {
+					ms = append(ms, &metric.Metric{
+						LabelKeys:   []string{"container", "image"},
+						LabelValues: []string{c.Name, c.Image},
+						Value:       1,
+					})
+				}
+
+				return &metric.Family{
+					Metrics: ms,
+				}
+			}),
+		},
+		{
+			Name: "kube_sidecarset_metadata_generation",
+			Type: metric.Gauge,
+			Help: "Sequence number representing a specific generation of the desired state.",
+			GenerateFunc: wrapSidecarSetFunc(func(s *kruiseappsv1alpha1.SidecarSet) *metric.Family {
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							Value: float64(s.ObjectMeta.Generation),
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: descSidecarSetAnnotationsName,
+			Type: metric.Gauge,
+			Help: descSidecarSetAnnotationsHelp,
+			GenerateFunc: wrapSidecarSetFunc(func(s *kruiseappsv1alpha1.SidecarSet) *metric.Family {
+				annotationKeys, annotationValues := createPrometheusLabelKeysValues("annotation", s.Annotations, allowAnnotationsList)
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							LabelKeys:   annotationKeys,
+							LabelValues: annotationValues,
+							Value:       1,
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: descSidecarSetLabelsName,
+			Type: metric.Gauge,
+			Help: descSidecarSetLabelsHelp,
+			GenerateFunc: wrapSidecarSetFunc(func(s *kruiseappsv1alpha1.SidecarSet) *metric.Family {
+				labelKeys, labelValues := createPrometheusLabelKeysValues("label", s.Labels, allowLabelsList)
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							LabelKeys:   labelKeys,
+							LabelValues: labelValues,
+							Value:       1,
+						},
+					},
+				}
+			}),
+		},
+	}
+}
+
+func wrapSidecarSetFunc(f func(*kruiseappsv1alpha1.SidecarSet) *metric.Family) func(interface{}) *metric.Family {
+	return func(obj interface{}) *metric.Family {
+		sidecarSet := obj.(*kruiseappsv1alpha1.SidecarSet)
+
+		metricFamily := f(sidecarSet)
+
+		for _, m := range metricFamily.Metrics {
+			m.LabelKeys = append(descSidecarSetLabelsDefaultLabels, m.LabelKeys...)
+			m.LabelValues = append([]string{sidecarSet.Name}, m.LabelValues...)
+		}
+
+		return metricFamily
+	}
+}
+
+// createSidecarSetListWatch ignores ns as SidecarSets are cluster-scoped.
+func createSidecarSetListWatch(kubeClient clientset.Interface, _ string) cache.ListerWatcher {
+	return &cache.ListWatch{
+		ListFunc: func(opts metav1.ListOptions) (runtime.Object, error) {
+			return kubeClient.AppsV1alpha1().SidecarSets().List(opts)
+		},
+		WatchFunc: func(opts metav1.ListOptions) (watch.Interface, error) {
+			return kubeClient.AppsV1alpha1().SidecarSets().Watch(opts)
+		},
+	}
+}
@@ -0,0 +1,372 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"k8s.io/kube-state-metrics/pkg/metric"
+
+	clientset "github.com/SchoIsles/kruise-state-metrics/pkg/client/clientset/versioned"
+	kruiseappsv1alpha1 "github.com/openkruise/kruise-api/apps/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+var (
+	descStatefulSetAnnotationsName     = "kube_kruise_statefulset_annotations"
+	descStatefulSetAnnotationsHelp     = "Kubernetes annotations converted to Prometheus labels."
+	descStatefulSetLabelsName          = "kube_kruise_statefulset_labels"
+	descStatefulSetLabelsHelp          = "Kubernetes labels converted to Prometheus labels."
+	descStatefulSetLabelsDefaultLabels = []string{"namespace", "statefulset"}
+)
+
+func statefulSetMetricFamilies(allowAnnotationsList, allowLabelsList []string) []metric.FamilyGenerator {
+	return []metric.FamilyGenerator{
+		{
+			Name: "kube_kruise_statefulset_created",
+			Type: metric.Gauge,
+			Help: "Unix creation timestamp",
+			GenerateFunc: wrapStatefulSetFunc(func(s *kruiseappsv1alpha1.StatefulSet) *metric.Family {
+				ms := []*metric.Metric{}
+
+				if !s.CreationTimestamp.IsZero() {
+					ms = append(ms, &metric.Metric{
+						Value: float64(s.CreationTimestamp.Unix()),
+					})
+				}
+
+				return &metric.Family{
+					Metrics: ms,
+				}
+			}),
+		},
+		{
+			Name: "kube_kruise_statefulset_status_replicas",
+			Type: metric.Gauge,
+			Help: "The number of replicas per advanced statefulset.",
+			GenerateFunc: wrapStatefulSetFunc(func(s *kruiseappsv1alpha1.StatefulSet) *metric.Family {
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							Value: float64(s.Status.Replicas),
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: "kube_kruise_statefulset_status_replicas_current",
+			Type: metric.Gauge,
+			Help: "The number of current replicas per advanced statefulset.",
+			GenerateFunc: wrapStatefulSetFunc(func(s *kruiseappsv1alpha1.StatefulSet) *metric.Family {
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							Value: float64(s.Status.CurrentReplicas),
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: "kube_kruise_statefulset_status_replicas_ready",
+			Type: metric.Gauge,
+			Help: "The number of ready replicas per advanced statefulset.",
+			GenerateFunc: wrapStatefulSetFunc(func(s *kruiseappsv1alpha1.StatefulSet) *metric.Family {
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							Value: float64(s.Status.ReadyReplicas),
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: "kube_kruise_statefulset_status_replicas_updated",
+			Type: metric.Gauge,
+			Help: "The number of updated replicas per advanced statefulset.",
+			GenerateFunc: wrapStatefulSetFunc(func(s *kruiseappsv1alpha1.StatefulSet) *metric.Family {
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							Value: float64(s.Status.UpdatedReplicas),
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: "kube_kruise_statefulset_status_observed_generation",
+			Type: metric.Gauge,
+			Help: "The generation observed by the advanced statefulset controller.",
+			GenerateFunc: wrapStatefulSetFunc(func(s *kruiseappsv1alpha1.StatefulSet) *metric.Family {
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							Value: float64(s.Status.ObservedGeneration),
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: "kube_kruise_statefulset_status_current_revision",
+			Type: metric.Gauge,
+			Help: "Indicates the version of the advanced statefulset used to generate Pods in the sequence [0,currentReplicas).",
+			GenerateFunc: wrapStatefulSetFunc(func(s *kruiseappsv1alpha1.StatefulSet) *metric.Family {
+				if s.Status.CurrentRevision == "" {
+					return &metric.Family{}
+				}
+
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							LabelKeys:   []string{"revision"},
+							LabelValues: []string{s.Status.CurrentRevision},
+							Value:       1,
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: "kube_kruise_statefulset_status_update_revision",
+			Type: metric.Gauge,
+			Help: "Indicates the version of the advanced statefulset used to generate Pods in the sequence [replicas-updatedReplicas,replicas)",
+			GenerateFunc: wrapStatefulSetFunc(func(s *kruiseappsv1alpha1.StatefulSet) *metric.Family {
+				if s.Status.UpdateRevision == "" {
+					return &metric.Family{}
+				}
+
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							LabelKeys:   []string{"revision"},
+							LabelValues: []string{s.Status.UpdateRevision},
+							Value:       1,
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: "kube_kruise_statefulset_replicas",
+			Type: metric.Gauge,
+			Help: "Number of desired pods for an advanced statefulset.",
+			GenerateFunc: wrapStatefulSetFunc(func(s *kruiseappsv1alpha1.StatefulSet) *metric.Family {
+				ms := []*metric.Metric{}
+
+				if s.Spec.Replicas != nil {
+					ms = append(ms, &metric.Metric{
+						Value: float64(*s.Spec.Replicas),
+					})
+				}
+
+				return &metric.Family{
+					Metrics: ms,
+				}
+			}),
+		},
+		{
+			Name: "kube_kruise_statefulset_spec_pod_management_policy",
+			Type: metric.Gauge,
+			Help: "The pod management policy of an advanced statefulset.",
+			GenerateFunc: wrapStatefulSetFunc(func(s *kruiseappsv1alpha1.StatefulSet) *metric.Family {
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							LabelKeys:   []string{"policy"},
+							LabelValues: []string{string(s.Spec.PodManagementPolicy)},
+							Value:       1,
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: "kube_kruise_statefulset_spec_strategy_rollingupdate_pod_update_policy",
+			Type: metric.Gauge,
+			Help: "The pod update policy used during a rolling update of an advanced statefulset.",
+			GenerateFunc: wrapStatefulSetFunc(func(s *kruiseappsv1alpha1.StatefulSet) *metric.Family {
+				if s.Spec.UpdateStrategy.RollingUpdate == nil {
+					return &metric.Family{}
+				}
+
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							LabelKeys:   []string{"policy"},
+							LabelValues: []string{string(s.Spec.UpdateStrategy.RollingUpdate.PodUpdatePolicy)},
+							Value:       1,
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: "kube_kruise_statefulset_spec_strategy_rollingupdate_partition",
+			Type: metric.Gauge,
+			Help: "The ordinal at which the advanced statefulset is partitioned for a rolling update.",
+			GenerateFunc: wrapStatefulSetFunc(func(s *kruiseappsv1alpha1.StatefulSet) *metric.Family {
+				if s.Spec.UpdateStrategy.RollingUpdate == nil || s.Spec.UpdateStrategy.RollingUpdate.Partition == nil {
+					return &metric.Family{}
+				}
+
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							Value: float64(*s.Spec.UpdateStrategy.RollingUpdate.Partition),
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: "kube_kruise_statefulset_spec_strategy_rollingupdate_max_unavailable",
+			Type: metric.Gauge,
+			Help: "Maximum number of unavailable replicas during a rolling update of an advanced statefulset.",
+			GenerateFunc: wrapStatefulSetFunc(func(s *kruiseappsv1alpha1.StatefulSet) *metric.Family {
+				if s.Spec.Replicas == nil || s.Spec.UpdateStrategy.RollingUpdate == nil || s.Spec.UpdateStrategy.RollingUpdate.MaxUnavailable == nil {
+					return &metric.Family{}
+				}
+
+				maxUnavailable, err := intstr.GetValueFromIntOrPercent(s.Spec.UpdateStrategy.RollingUpdate.MaxUnavailable, int(*s.Spec.Replicas), true)
+				if err != nil {
+					return generateError("kube_kruise_statefulset_spec_strategy_rollingupdate_max_unavailable", s, err)
+				}
+
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							Value: float64(maxUnavailable),
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: "kube_kruise_statefulset_spec_paused",
+			Type: metric.Gauge,
+			Help: "Whether the rolling update of an advanced statefulset is paused.",
+			GenerateFunc: wrapStatefulSetFunc(func(s *kruiseappsv1alpha1.StatefulSet) *metric.Family {
+				paused := s.Spec.UpdateStrategy.RollingUpdate != nil && s.Spec.UpdateStrategy.RollingUpdate.Paused
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							Value: boolFloat64(paused),
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: "kube_kruise_statefulset_spec_revision_history_limit",
+			Type: metric.Gauge,
+			Help: "Number of old revisions retained for an advanced statefulset.",
+			GenerateFunc: wrapStatefulSetFunc(func(s *kruiseappsv1alpha1.StatefulSet) *metric.Family {
+				ms := []*metric.Metric{}
+
+				if s.Spec.RevisionHistoryLimit != nil {
+					ms = append(ms, &metric.Metric{
+						Value: float64(*s.Spec.RevisionHistoryLimit),
+					})
+				}
+
+				return &metric.Family{
+					Metrics: ms,
+				}
+			}),
+		},
+		{
+			Name: "kube_kruise_statefulset_metadata_generation",
+			Type: metric.Gauge,
+			Help: "Sequence number representing a specific generation of the desired state for the advanced statefulset.",
+			GenerateFunc: wrapStatefulSetFunc(func(s *kruiseappsv1alpha1.StatefulSet) *metric.Family {
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							Value: float64(s.ObjectMeta.Generation),
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: descStatefulSetAnnotationsName,
+			Type: metric.Gauge,
+			Help: descStatefulSetAnnotationsHelp,
+			GenerateFunc: wrapStatefulSetFunc(func(s *kruiseappsv1alpha1.StatefulSet) *metric.Family {
+				annotationKeys, annotationValues := createPrometheusLabelKeysValues("annotation", s.Annotations, allowAnnotationsList)
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							LabelKeys:   annotationKeys,
+							LabelValues: annotationValues,
+							Value:       1,
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: descStatefulSetLabelsName,
+			Type: metric.Gauge,
+			Help: descStatefulSetLabelsHelp,
+			GenerateFunc: wrapStatefulSetFunc(func(s *kruiseappsv1alpha1.StatefulSet) *metric.Family {
+				labelKeys, labelValues := createPrometheusLabelKeysValues("label", s.Labels, allowLabelsList)
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							LabelKeys:   labelKeys,
+							LabelValues: labelValues,
+							Value:       1,
+						},
+					},
+				}
+			}),
+		},
+	}
+}
+
+func wrapStatefulSetFunc(f func(*kruiseappsv1alpha1.StatefulSet) *metric.Family) func(interface{}) *metric.Family {
+	return func(obj interface{}) *metric.Family {
+		statefulSet := obj.(*kruiseappsv1alpha1.StatefulSet)
+
+		metricFamily := f(statefulSet)
+
+		for _, m := range metricFamily.Metrics {
+			m.LabelKeys = append(descStatefulSetLabelsDefaultLabels, m.LabelKeys...)
+			m.LabelValues = append([]string{statefulSet.Namespace, statefulSet.Name}, m.LabelValues...)
+		}
+
+		return metricFamily
+	}
+}
+
+func createStatefulSetListWatch(kubeClient clientset.Interface, ns string) cache.ListerWatcher {
+	return &cache.ListWatch{
+		ListFunc: func(opts metav1.ListOptions) (runtime.Object, error) {
+			return kubeClient.AppsV1alpha1().StatefulSets(ns).List(opts)
+		},
+		WatchFunc: func(opts metav1.ListOptions) (watch.Interface, error) {
+			return kubeClient.AppsV1alpha1().StatefulSets(ns).Watch(opts)
+		},
+	}
+}
@@ -0,0 +1,158 @@
+/*
+Copyright 2018 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"sort"
+	"sync"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/cache"
+)
+
+// allNamespacesKey is used instead of metav1.NamespaceAll when reporting the
+// sync status of a reflector watching all namespaces.
+const allNamespacesKey = "*"
+
+// CollectorSyncStatus reports whether the reflector of a collector has
+// completed its initial List, both overall and per namespace.
+type CollectorSyncStatus struct {
+	Collector  string          `json:"collector"`
+	Synced     bool            `json:"synced"`
+	Namespaces map[string]bool `json:"namespaces"`
+}
+
+// storeSync tracks the sync status of a single store.
+type storeSync struct {
+	mtx        sync.RWMutex
+	collector  string
+	synced     bool
+	namespaces map[string]bool
+}
+
+func newStoreSync(namespaces []string) *storeSync {
+	s := &storeSync{namespaces: map[string]bool{}}
+	for _, ns := range namespaces {
+		s.namespaces[namespaceKey(ns)] = false
+	}
+	return s
+}
+
+func (s *storeSync) setNamespaceSynced(ns string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.namespaces[namespaceKey(ns)] = true
+}
+
+func (s *storeSync) setSynced() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.synced = true
+}
+
+func (s *storeSync) status() CollectorSyncStatus {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	namespaces := make(map[string]bool, len(s.namespaces))
+	for ns, synced := range s.namespaces {
+		namespaces[ns] = synced
+	}
+	return CollectorSyncStatus{
+		Collector:  s.collector,
+		Synced:     s.synced,
+		Namespaces: namespaces,
+	}
+}
+
+func namespaceKey(ns string) string {
+	if ns == metav1.NamespaceAll {
+		return allNamespacesKey
+	}
+	return ns
+}
+
+// syncTracker holds the sync status of every store built by a Builder.
+type syncTracker struct {
+	mtx    sync.RWMutex
+	stores map[cache.Store]*storeSync
+}
+
+func newSyncTracker() *syncTracker {
+	return &syncTracker{stores: map[cache.Store]*storeSync{}}
+}
+
+func (t *syncTracker) add(store cache.Store, s *storeSync) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.stores[store] = s
+}
+
+func (t *syncTracker) setCollector(store cache.Store, collector string) {
+	t.mtx.RLock()
+	defer t.mtx.RUnlock()
+	if s, ok := t.stores[store]; ok {
+		s.mtx.Lock()
+		s.collector = collector
+		s.mtx.Unlock()
+	}
+}
+
+func (t *syncTracker) status() []CollectorSyncStatus {
+	t.mtx.RLock()
+	defer t.mtx.RUnlock()
+
+	statuses := make([]CollectorSyncStatus, 0, len(t.stores))
+	for _, s := range t.stores {
+		statuses = append(statuses, s.status())
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Collector < statuses[j].Collector })
+	return statuses
+}
+
+// syncedStore marks its storeSync as synced once the reflector replaced the
+// store content with the result of its initial List.
+type syncedStore struct {
+	cache.Store
+	sync *storeSync
+}
+
+func (s *syncedStore) Replace(list []interface{}, resourceVersion string) error {
+	if err := s.Store.Replace(list, resourceVersion); err != nil {
+		return err
+	}
+	s.sync.setSynced()
+	return nil
+}
+
+// syncedListerWatcher marks a namespace of its storeSync as synced once a List
+// for it succeeded.
+type syncedListerWatcher struct {
+	cache.ListerWatcher
+	namespace string
+	sync      *storeSync
+}
+
+func (lw *syncedListerWatcher) List(options metav1.ListOptions) (runtime.Object, error) {
+	obj, err := lw.ListerWatcher.List(options)
+	if err != nil {
+		return nil, err
+	}
+	lw.sync.setNamespaceSynced(lw.namespace)
+	return obj, nil
+}
@@ -0,0 +1,317 @@
+/*
+Copyright 2018 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	kruiseappsv1alpha1 "github.com/openkruise/kruise-api/apps/v1alpha1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Reasons of the workload events emitted on transitions.
+const (
+	ReasonRevisionChanged  = "RevisionChanged"
+	ReasonPaused           = "Paused"
+	ReasonResumed          = "Resumed"
+	ReasonPartitionChanged = "PartitionChanged"
+	ReasonConditionFailing = "ConditionFailing"
+)
+
+// WorkloadEvent describes a transition of a watched Kruise workload.
+type WorkloadEvent struct {
+	Time      time.Time      `json:"time"`
+	Cluster   string         `json:"cluster,omitempty"`
+	Kind      string         `json:"kind"`
+	Namespace string         `json:"namespace,omitempty"`
+	Name      string         `json:"name"`
+	Reason    string         `json:"reason"`
+	Message   string         `json:"message"`
+	Warning   bool           `json:"warning"`
+	Object    runtime.Object `json:"-"`
+}
+
+// EventSink receives the workload events detected by a Builder.
+type EventSink interface {
+	Emit(e WorkloadEvent)
+}
+
+// workloadState is the part of a workload's state whose transitions are
+// reported as events.
+type workloadState struct {
+	kind      string
+	uid       types.UID
+	namespace string
+	name      string
+	revision  string
+	paused    bool
+	partition *int32
+	// failing maps the type of every failing condition to its message.
+	failing map[string]string
+}
+
+// transitionSources maps the type of every workload whose transitions are
+// reported to its kind and a function extracting its state.
+var transitionSources = map[reflect.Type]struct {
+	kind  string
+	state func(obj interface{}) workloadState
+}{
+	reflect.TypeOf(&kruiseappsv1alpha1.CloneSet{}): {"CloneSet", func(obj interface{}) workloadState {
+		c := obj.(*kruiseappsv1alpha1.CloneSet)
+		failing := map[string]string{}
+		for _, cond := range c.Status.Conditions {
+			if isFailingCondition(string(cond.Type), cond.Status) {
+				failing[string(cond.Type)] = cond.Message
+			}
+		}
+		return workloadState{
+			kind:      "CloneSet",
+			uid:       c.UID,
+			namespace: c.Namespace,
+			name:      c.Name,
+			revision:  c.Status.UpdateRevision,
+			paused:    c.Spec.UpdateStrategy.Paused,
+			partition: c.Spec.UpdateStrategy.Partition,
+			failing:   failing,
+		}
+	}},
+	reflect.TypeOf(&kruiseappsv1alpha1.StatefulSet{}): {"StatefulSet", func(obj interface{}) workloadState {
+		s := obj.(*kruiseappsv1alpha1.StatefulSet)
+		failing := map[string]string{}
+		for _, cond := range s.Status.Conditions {
+			if isFailingCondition(string(cond.Type), cond.Status) {
+				failing[string(cond.Type)] = cond.Message
+			}
+		}
+		state := workloadState{
+			kind:      "StatefulSet",
+			uid:       s.UID,
+			namespace: s.Namespace,
+			name:      s.Name,
+			revision:  s.Status.UpdateRevision,
+			failing:   failing,
+		}
+		if ru := s.Spec.UpdateStrategy.RollingUpdate; ru != nil {
+			state.paused = ru.Paused
+			state.partition = ru.Partition
+		}
+		return state
+	}},
+	reflect.TypeOf(&kruiseappsv1alpha1.DaemonSet{}): {"DaemonSet", func(obj interface{}) workloadState {
+		d := obj.(*kruiseappsv1alpha1.DaemonSet)
+		failing := map[string]string{}
+		for _, cond := range d.Status.Conditions {
+			if isFailingCondition(string(cond.Type), cond.Status) {
+				failing[string(cond.Type)] = cond.Message
+			}
+		}
+		state := workloadState{
+			kind:      "DaemonSet",
+			uid:       d.UID,
+			namespace: d.Namespace,
+			name:      d.Name,
+			revision:  d.Status.DaemonSetHash,
+			failing:   failing,
+		}
+		if ru := d.Spec.UpdateStrategy.RollingUpdate; ru != nil {
+			state.paused = ru.Paused != nil && *ru.Paused
+			state.partition = ru.Partition
+		}
+		return state
+	}},
+}
+
+// isFailingCondition reports whether a condition signals a failure, such as
+// the FailedScale and FailedUpdate conditions of a CloneSet.
+func isFailingCondition(conditionType string, status v1.ConditionStatus) bool {
+	return strings.HasPrefix(conditionType, "Failed") && status == v1.ConditionTrue
+}
+
+// transitionTracker remembers the last observed state of every workload and
+// emits an event for each transition between two observations.
+type transitionTracker struct {
+	mtx     sync.Mutex
+	now     func() time.Time
+	cluster string
+	sink    EventSink
+	states  map[rolloutKey]workloadState
+}
+
+func newTransitionTracker(cluster string, sink EventSink) *transitionTracker {
+	return &transitionTracker{
+		now:     time.Now,
+		cluster: cluster,
+		sink:    sink,
+		states:  map[rolloutKey]workloadState{},
+	}
+}
+
+// wrapStore returns a store that feeds the tracker with every change applied
+// to store, or store itself if transitions of expectedType are not reported.
+func (t *transitionTracker) wrapStore(expectedType interface{}, store cache.Store) cache.Store {
+	source, ok := transitionSources[reflect.TypeOf(expectedType)]
+	if !ok {
+		return store
+	}
+	return &transitionStore{Store: store, tracker: t, kind: source.kind, state: source.state}
+}
+
+func (t *transitionTracker) observe(obj interface{}, s workloadState) {
+	t.mtx.Lock()
+	key := rolloutKey{kind: s.kind, uid: s.uid}
+	prev, ok := t.states[key]
+	t.states[key] = s
+	t.mtx.Unlock()
+
+	if !ok {
+		return
+	}
+	for _, e := range transitions(prev, s) {
+		e.Time = t.now()
+		e.Cluster = t.cluster
+		e.Kind = s.kind
+		e.Namespace = s.namespace
+		e.Name = s.name
+		if o, ok := obj.(runtime.Object); ok {
+			e.Object = o
+		}
+		t.sink.Emit(e)
+	}
+}
+
+func (t *transitionTracker) forget(s workloadState) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	delete(t.states, rolloutKey{kind: s.kind, uid: s.uid})
+}
+
+// prune forgets the workloads of the given kind that are not listed.
+func (t *transitionTracker) prune(kind string, listed map[types.UID]struct{}) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	for key := range t.states {
+		if _, ok := listed[key.uid]; !ok && key.kind == kind {
+			delete(t.states, key)
+		}
+	}
+}
+
+// transitions returns the events describing the changes from prev to cur.
+func transitions(prev, cur workloadState) []WorkloadEvent {
+	events := []WorkloadEvent{}
+
+	if cur.revision != prev.revision && cur.revision != "" {
+		events = append(events, WorkloadEvent{
+			Reason:  ReasonRevisionChanged,
+			Message: fmt.Sprintf("Update revision changed from %q to %q", prev.revision, cur.revision),
+		})
+	}
+
+	if cur.paused != prev.paused {
+		e := WorkloadEvent{Reason: ReasonResumed, Message: "Update resumed"}
+		if cur.paused {
+			e = WorkloadEvent{Reason: ReasonPaused, Message: "Update paused"}
+		}
+		events = append(events, e)
+	}
+
+	if !reflect.DeepEqual(cur.partition, prev.partition) {
+		events = append(events, WorkloadEvent{
+			Reason:  ReasonPartitionChanged,
+			Message: fmt.Sprintf("Partition changed from %s to %s", formatPartition(prev.partition), formatPartition(cur.partition)),
+		})
+	}
+
+	conditions := []string{}
+	for c := range cur.failing {
+		if _, ok := prev.failing[c]; !ok {
+			conditions = append(conditions, c)
+		}
+	}
+	sort.Strings(conditions)
+	for _, c := range conditions {
+		events = append(events, WorkloadEvent{
+			Reason:  ReasonConditionFailing,
+			Message: fmt.Sprintf("Condition %s is failing: %s", c, cur.failing[c]),
+			Warning: true,
+		})
+	}
+
+	return events
+}
+
+func formatPartition(p *int32) string {
+	if p == nil {
+		return "none"
+	}
+	return fmt.Sprintf("%d", *p)
+}
+
+// transitionStore is a cache.Store that passes every change on to the
+// transition tracker after applying it to the wrapped store.
+type transitionStore struct {
+	cache.Store
+	tracker *transitionTracker
+	kind    string
+	state   func(obj interface{}) workloadState
+}
+
+func (s *transitionStore) Add(obj interface{}) error {
+	if err := s.Store.Add(obj); err != nil {
+		return err
+	}
+	s.tracker.observe(obj, s.state(obj))
+	return nil
+}
+
+func (s *transitionStore) Update(obj interface{}) error {
+	if err := s.Store.Update(obj); err != nil {
+		return err
+	}
+	s.tracker.observe(obj, s.state(obj))
+	return nil
+}
+
+func (s *transitionStore) Delete(obj interface{}) error {
+	if err := s.Store.Delete(obj); err != nil {
+		return err
+	}
+	s.tracker.forget(s.state(obj))
+	return nil
+}
+
+func (s *transitionStore) Replace(list []interface{}, resourceVersion string) error {
+	if err := s.Store.Replace(list, resourceVersion); err != nil {
+		return err
+	}
+	listed := make(map[types.UID]struct{}, len(list))
+	for _, obj := range list {
+		state := s.state(obj)
+		listed[state.uid] = struct{}{}
+		s.tracker.observe(obj, state)
+	}
+	s.tracker.prune(s.kind, listed)
+	return nil
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2018 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTransitions(t *testing.T) {
+	one, two := int32(1), int32(2)
+
+	tests := []struct {
+		name string
+		prev workloadState
+		cur  workloadState
+		want []WorkloadEvent
+	}{
+		{
+			name: "unchanged",
+			prev: workloadState{revision: "a", partition: &one},
+			cur:  workloadState{revision: "a", partition: &one},
+			want: []WorkloadEvent{},
+		},
+		{
+			name: "revision changed",
+			prev: workloadState{revision: "a"},
+			cur:  workloadState{revision: "b"},
+			want: []WorkloadEvent{
+				{Reason: ReasonRevisionChanged, Message: `Update revision changed from "a" to "b"`},
+			},
+		},
+		{
+			name: "revision cleared",
+			prev: workloadState{revision: "a"},
+			cur:  workloadState{},
+			want: []WorkloadEvent{},
+		},
+		{
+			name: "paused",
+			prev: workloadState{},
+			cur:  workloadState{paused: true},
+			want: []WorkloadEvent{
+				{Reason: ReasonPaused, Message: "Update paused"},
+			},
+		},
+		{
+			name: "resumed",
+			prev: workloadState{paused: true},
+			cur:  workloadState{},
+			want: []WorkloadEvent{
+				{Reason: ReasonResumed, Message: "Update resumed"},
+			},
+		},
+		{
+			name: "partition set",
+			prev: workloadState{},
+			cur:  workloadState{partition: &one},
+			want: []WorkloadEvent{
+				{Reason: ReasonPartitionChanged, Message: "Partition changed from none to 1"},
+			},
+		},
+		{
+			name: "partition changed",
+			prev: workloadState{partition: &two},
+			cur:  workloadState{partition: &one},
+			want: []WorkloadEvent{
+				{Reason: ReasonPartitionChanged, Message: "Partition changed from 2 to 1"},
+			},
+		},
+		{
+			name: "partition removed",
+			prev: workloadState{partition: &one},
+			cur:  workloadState{},
+			want: []WorkloadEvent{
+				{Reason: ReasonPartitionChanged, Message: "Partition changed from 1 to none"},
+			},
+		},
+		{
+			name: "condition newly failing",
+			prev: workloadState{failing: map[string]string{"FailedScale": "quota"}},
+			cur:  workloadState{failing: map[string]string{"FailedScale": "quota", "FailedUpdate": "image"}},
+			want: []WorkloadEvent{
+				{Reason: ReasonConditionFailing, Message: "Condition FailedUpdate is failing: image", Warning: true},
+			},
+		},
+		{
+			name: "condition recovered",
+			prev: workloadState{failing: map[string]string{"FailedScale": "quota"}},
+			cur:  workloadState{failing: map[string]string{}},
+			want: []WorkloadEvent{},
+		},
+		{
+			name: "several transitions",
+			prev: workloadState{revision: "a"},
+			cur:  workloadState{revision: "b", paused: true, failing: map[string]string{"FailedUpdate": "image"}},
+			want: []WorkloadEvent{
+				{Reason: ReasonRevisionChanged, Message: `Update revision changed from "a" to "b"`},
+				{Reason: ReasonPaused, Message: "Update paused"},
+				{Reason: ReasonConditionFailing, Message: "Condition FailedUpdate is failing: image", Warning: true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := transitions(tt.prev, tt.cur)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("transitions() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,327 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"sort"
+
+	"k8s.io/kube-state-metrics/pkg/metric"
+
+	clientset "github.com/SchoIsles/kruise-state-metrics/pkg/client/clientset/versioned"
+	kruiseappsv1alpha1 "github.com/openkruise/kruise-api/apps/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+var (
+	descUnitedDeploymentAnnotationsName     = "kube_uniteddeployment_annotations"
+	descUnitedDeploymentAnnotationsHelp     = "Kubernetes annotations converted to Prometheus labels."
+	descUnitedDeploymentLabelsName          = "kube_uniteddeployment_labels"
+	descUnitedDeploymentLabelsHelp          = "Kubernetes labels converted to Prometheus labels."
+	descUnitedDeploymentLabelsDefaultLabels = []string{"namespace", "uniteddeployment"}
+)
+
+func unitedDeploymentMetricFamilies(allowAnnotationsList, allowLabelsList []string) []metric.FamilyGenerator {
+	return []metric.FamilyGenerator{
+		{
+			Name: "kube_uniteddeployment_created",
+			Type: metric.Gauge,
+			Help: "Unix creation timestamp",
+			GenerateFunc: wrapUnitedDeploymentFunc(func(u *kruiseappsv1alpha1.UnitedDeployment) *metric.Family {
+				ms := []*metric.Metric{}
+
+				if !u.CreationTimestamp.IsZero() {
+					ms = append(ms, &metric.Metric{
+						Value: float64(u.CreationTimestamp.Unix()),
+					})
+				}
+
+				return &metric.Family{
+					Metrics: ms,
+				}
+			}),
+		},
+		{
+			Name: "kube_uniteddeployment_status_replicas",
+			Type: metric.Gauge,
+			Help: "The number of replicas per uniteddeployment.",
+			GenerateFunc: wrapUnitedDeploymentFunc(func(u *kruiseappsv1alpha1.UnitedDeployment) *metric.Family {
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							Value: float64(u.Status.Replicas),
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: "kube_uniteddeployment_status_replicas_ready",
+			Type: metric.Gauge,
+			Help: "The number of ready replicas per uniteddeployment.",
+			GenerateFunc: wrapUnitedDeploymentFunc(func(u *kruiseappsv1alpha1.UnitedDeployment) *metric.Family {
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							Value: float64(u.Status.ReadyReplicas),
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: "kube_uniteddeployment_status_replicas_updated",
+			Type: metric.Gauge,
+			Help: "The number of updated replicas per uniteddeployment.",
+			GenerateFunc: wrapUnitedDeploymentFunc(func(u *kruiseappsv1alpha1.UnitedDeployment) *metric.Family {
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							Value: float64(u.Status.UpdatedReplicas),
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: "kube_uniteddeployment_status_replicas_ready_updated",
+			Type: metric.Gauge,
+			Help: "The number of ready updated replicas per uniteddeployment.",
+			GenerateFunc: wrapUnitedDeploymentFunc(func(u *kruiseappsv1alpha1.UnitedDeployment) *metric.Family {
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							Value: float64(u.Status.UpdatedReadyReplicas),
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: "kube_uniteddeployment_status_observed_generation",
+			Type: metric.Gauge,
+			Help: "The generation observed by the uniteddeployment controller.",
+			GenerateFunc: wrapUnitedDeploymentFunc(func(u *kruiseappsv1alpha1.UnitedDeployment) *metric.Family {
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							Value: float64(u.Status.ObservedGeneration),
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: "kube_uniteddeployment_status_current_revision",
+			Type: metric.Gauge,
+			Help: "Indicates the current revision of the uniteddeployment.",
+			GenerateFunc: wrapUnitedDeploymentFunc(func(u *kruiseappsv1alpha1.UnitedDeployment) *metric.Family {
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							LabelKeys:   []string{"revision"},
+							LabelValues: []string{u.Status.CurrentRevision},
+							Value:       1,
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: "kube_uniteddeployment_status_update_revision",
+			Type: metric.Gauge,
+			Help: "Indicates the revision the uniteddeployment is being updated to.",
+			GenerateFunc: wrapUnitedDeploymentFunc(func(u *kruiseappsv1alpha1.UnitedDeployment) *metric.Family {
+				if u.Status.UpdateStatus == nil {
+					return &metric.Family{}
+				}
+
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							LabelKeys:   []string{"revision"},
+							LabelValues: []string{u.Status.UpdateStatus.UpdatedRevision},
+							Value:       1,
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: "kube_uniteddeployment_status_condition",
+			Type: metric.Gauge,
+			Help: "The current status conditions of a uniteddeployment.",
+			GenerateFunc: wrapUnitedDeploymentFunc(func(u *kruiseappsv1alpha1.UnitedDeployment) *metric.Family {
+				ms := make([]*metric.Metric, len(u.Status.Conditions)*len(conditionStatuses))
+
+				for i, c := range u.Status.Conditions {
+					conditionMetrics := addConditionMetrics(c.Status)
+
+					for j, m := range conditionMetrics {
+						metric := m
+
+						metric.LabelKeys = []string{"condition", "status"}
+						metric.LabelValues = append([]string{string(c.Type)}, metric.LabelValues...)
+						ms[i*len(conditionStatuses)+j] = metric
+					}
+				}
+
+				return &metric.Family{
+					Metrics: ms,
+				}
+			}),
+		},
+		{
+			Name: "kube_uniteddeployment_spec_replicas",
+			Type: metric.Gauge,
+			Help: "Number of desired pods for a uniteddeployment.",
+			GenerateFunc: wrapUnitedDeploymentFunc(func(u *kruiseappsv1alpha1.UnitedDeployment) *metric.Family {
+				ms := []*metric.Metric{}
+
+				if u.Spec.Replicas != nil {
+					ms = append(ms, &metric.Metric{
+						Value: float64(*u.Spec.Replicas),
+					})
+				}
+
+				return &metric.Family{
+					Metrics: ms,
+				}
+			}),
+		},
+		{
+			Name: "kube_uniteddeployment_status_subset_replicas",
+			Type: metric.Gauge,
+			Help: "Number of desired pods for each subset of a uniteddeployment.",
+			GenerateFunc: wrapUnitedDeploymentFunc(func(u *kruiseappsv1alpha1.UnitedDeployment) *metric.Family {
+				return &metric.Family{
+					Metrics: subsetMetrics(u.Status.SubsetReplicas),
+				}
+			}),
+		},
+		{
+			Name: "kube_uniteddeployment_status_subset_partition",
+			Type: metric.Gauge,
+			Help: "The partition currently applied to each subset of a uniteddeployment during a manual update.",
+			GenerateFunc: wrapUnitedDeploymentFunc(func(u *kruiseappsv1alpha1.UnitedDeployment) *metric.Family {
+				if u.Status.UpdateStatus == nil {
+					return &metric.Family{}
+				}
+
+				return &metric.Family{
+					Metrics: subsetMetrics(u.Status.UpdateStatus.CurrentPartitions),
+				}
+			}),
+		},
+		{
+			Name: "kube_uniteddeployment_metadata_generation",
+			Type: metric.Gauge,
+			Help: "Sequence number representing a specific generation of the desired state.",
+			GenerateFunc: wrapUnitedDeploymentFunc(func(u *kruiseappsv1alpha1.UnitedDeployment) *metric.Family {
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							Value: float64(u.ObjectMeta.Generation),
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: descUnitedDeploymentAnnotationsName,
+			Type: metric.Gauge,
+			Help: descUnitedDeploymentAnnotationsHelp,
+			GenerateFunc: wrapUnitedDeploymentFunc(func(u *kruiseappsv1alpha1.UnitedDeployment) *metric.Family {
+				annotationKeys, annotationValues := createPrometheusLabelKeysValues("annotation", u.Annotations, allowAnnotationsList)
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							LabelKeys:   annotationKeys,
+							LabelValues: annotationValues,
+							Value:       1,
+						},
+					},
+				}
+			}),
+		},
+		{
+			Name: descUnitedDeploymentLabelsName,
+			Type: metric.Gauge,
+			Help: descUnitedDeploymentLabelsHelp,
+			GenerateFunc: wrapUnitedDeploymentFunc(func(u *kruiseappsv1alpha1.UnitedDeployment) *metric.Family {
+				labelKeys, labelValues := createPrometheusLabelKeysValues("label", u.Labels, allowLabelsList)
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							LabelKeys:   labelKeys,
+							LabelValues: labelValues,
+							Value:       1,
+						},
+					},
+				}
+			}),
+		},
+	}
+}
+
+// subsetMetrics generates one metric per subset, sorted by subset name, from
+// a map keyed by subset name.
+func subsetMetrics(subsets map[string]int32) []*metric.Metric {
+	names := make([]string, 0, len(subsets))
+	for name := range subsets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	ms := make([]*metric.Metric, 0, len(names))
+	for _, name := range names {
+		ms = append(ms, &metric.Metric{
+			LabelKeys:   []string{"subset"},
+			LabelValues: []string{name},
+			Value:       float64(subsets[name]),
+		})
+	}
+	return ms
+}
+
+func wrapUnitedDeploymentFunc(f func(*kruiseappsv1alpha1.UnitedDeployment) *metric.Family) func(interface{}) *metric.Family {
+	return func(obj interface{}) *metric.Family {
+		unitedDeployment := obj.(*kruiseappsv1alpha1.UnitedDeployment)
+
+		metricFamily := f(unitedDeployment)
+
+		for _, m := range metricFamily.Metrics {
+			m.LabelKeys = append(descUnitedDeploymentLabelsDefaultLabels, m.LabelKeys...)
+			m.LabelValues = append([]string{unitedDeployment.Namespace, unitedDeployment.Name}, m.LabelValues...)
+		}
+
+		return metricFamily
+	}
+}
+
+func createUnitedDeploymentListWatch(kubeClient clientset.Interface, ns string) cache.ListerWatcher {
+	return &cache.ListWatch{
+		ListFunc: func(opts metav1.ListOptions) (runtime.Object, error) {
+			return kubeClient.AppsV1alpha1().UnitedDeployments(ns).List(opts)
+		},
+		WatchFunc: func(opts metav1.ListOptions) (watch.Interface, error) {
+			return kubeClient.AppsV1alpha1().UnitedDeployments(ns).Watch(opts)
+		},
+	}
+}
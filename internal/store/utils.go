@@ -23,18 +23,74 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/klog"
 
 	v1 "k8s.io/api/core/v1"
 
 	"k8s.io/kube-state-metrics/pkg/metric"
+
+	"github.com/SchoIsles/kruise-state-metrics/pkg/options"
 )
 
 var (
 	invalidLabelCharRE = regexp.MustCompile(`[^a-zA-Z0-9_]`)
 	conditionStatuses  = []v1.ConditionStatus{v1.ConditionTrue, v1.ConditionFalse, v1.ConditionUnknown}
+
+	labelCollisionsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kruise_state_metrics_label_collisions_total",
+			Help: "Total number of Kubernetes label or annotation keys dropped because they collide with another key after sanitization, counted every time the labels or annotations metric of an object is generated.",
+		},
+		[]string{"prefix"},
+	)
+
+	generateErrorsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kruise_state_metrics_generate_errors_total",
+			Help: "Total number of times a metric family could not be generated for an object.",
+		},
+		[]string{"family"},
+	)
 )
 
+// generateError logs why the named family could not be generated for obj,
+// counts it and returns an empty family so that only the affected series is
+// skipped.
+func generateError(family string, obj interface{}, err error) *metric.Family {
+	generateErrorsTotal.WithLabelValues(family).Inc()
+
+	if o, accessorErr := meta.Accessor(obj); accessorErr == nil {
+		klog.Errorf("Failed to generate %s for %s/%s: %v", family, o.GetNamespace(), o.GetName(), err)
+	} else {
+		klog.Errorf("Failed to generate %s: %v", family, err)
+	}
+
+	return &metric.Family{}
+}
+
+// recoverFamilyGenerators guards the generate function of every family so
+// that a panic while generating one family of one object is handled like a
+// generation error instead of crashing the exporter.
+func recoverFamilyGenerators(families []metric.FamilyGenerator) []metric.FamilyGenerator {
+	recovered := make([]metric.FamilyGenerator, len(families))
+	for i, f := range families {
+		name, generate := f.Name, f.GenerateFunc
+		f.GenerateFunc = func(obj interface{}) (family *metric.Family) {
+			defer func() {
+				if r := recover(); r != nil {
+					family = generateError(name, obj, fmt.Errorf("panic: %v", r))
+				}
+			}()
+			return generate(obj)
+		}
+		recovered[i] = f
+	}
+	return recovered
+}
+
 func resourceVersionMetric(rv string) []*metric.Metric {
 	v, err := strconv.ParseFloat(rv, 64)
 	if err != nil {
@@ -72,20 +128,53 @@ func addConditionMetrics(cs v1.ConditionStatus) []*metric.Metric {
 	return ms
 }
 
-func kubeLabelsToPrometheusLabels(labels map[string]string) ([]string, []string) {
-	return mapToPrometheusLabels(labels, "label")
+// createPrometheusLabelKeysValues converts the Kubernetes labels or
+// annotations in allKubeData that are allowed by allowKubeData to Prometheus
+// labels with the given prefix.
+func createPrometheusLabelKeysValues(prefix string, allKubeData map[string]string, allowKubeData []string) ([]string, []string) {
+	allowedKubeData := make(map[string]string)
+
+	for _, l := range allowKubeData {
+		if l == options.LabelWildcard {
+			return mapToPrometheusLabels(allKubeData, prefix)
+		}
+
+		v, found := allKubeData[l]
+		if found {
+			allowedKubeData[l] = v
+		}
+	}
+
+	return mapToPrometheusLabels(allowedKubeData, prefix)
 }
 
+// mapToPrometheusLabels converts the given map to Prometheus label keys and
+// values, prefixing and sanitizing the keys. Keys that collide after
+// sanitization, e.g. "app.kubernetes.io/name" and "app_kubernetes_io/name",
+// are resolved deterministically: the first key in sorted order wins and the
+// others are dropped. As this runs on every Add and Update of an object, a
+// collision is only logged at verbosity 4 and labelCollisionsTotal counts
+// dropped keys per generation rather than distinct collisions.
 func mapToPrometheusLabels(labels map[string]string, prefix string) ([]string, []string) {
-	labelKeys := make([]string, 0, len(labels))
+	keys := make([]string, 0, len(labels))
 	for k := range labels {
-		labelKeys = append(labelKeys, k)
+		keys = append(keys, k)
 	}
-	sort.Strings(labelKeys)
+	sort.Strings(keys)
 
+	labelKeys := make([]string, 0, len(labels))
 	labelValues := make([]string, 0, len(labels))
-	for i, k := range labelKeys {
-		labelKeys[i] = prefix + "_" + sanitizeLabelName(k)
+	seen := make(map[string]string, len(labels))
+	for _, k := range keys {
+		labelKey := prefix + "_" + sanitizeLabelName(k)
+		if first, ok := seen[labelKey]; ok {
+			klog.V(4).Infof("%s key %q collides with %q as Prometheus label %s, dropping it", prefix, k, first, labelKey)
+			labelCollisionsTotal.WithLabelValues(prefix).Inc()
+			continue
+		}
+		seen[labelKey] = k
+
+		labelKeys = append(labelKeys, labelKey)
 		labelValues = append(labelValues, labels[k])
 	}
 	return labelKeys, labelValues
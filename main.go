@@ -6,27 +6,35 @@ import (
 	"net/http"
 	"net/http/pprof"
 	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/SchoIsles/kruise-state-metrics/pkg/metricshandler"
+	"github.com/SchoIsles/kruise-state-metrics/pkg/options"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/klog"
-	"k8s.io/kube-state-metrics/pkg/options"
 	"k8s.io/kube-state-metrics/pkg/util/proc"
 	"k8s.io/kube-state-metrics/pkg/version"
-	"k8s.io/kube-state-metrics/pkg/whiteblacklist"
 
 	"context"
 
 	"github.com/SchoIsles/kruise-state-metrics/internal/store"
 	clientset "github.com/SchoIsles/kruise-state-metrics/pkg/client/clientset/versioned"
+	"github.com/SchoIsles/kruise-state-metrics/pkg/eventsink"
 )
 
 const (
 	metricsPath = "/metrics"
 	healthzPath = "/healthz"
+	readyzPath  = "/readyz"
 )
 
 // promLogger implements promhttp.Logger
@@ -43,6 +51,16 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// Stop serving on SIGINT and SIGTERM so that the event sinks below are
+	// closed and flush the events they still buffer.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		s := <-signals
+		klog.Infof("Received %s, shutting down", s)
+		cancel()
+	}()
+
 	err := opts.Parse()
 	if err != nil {
 		klog.Fatalf("Error: %s", err)
@@ -58,59 +76,176 @@ func main() {
 		os.Exit(0)
 	}
 
-	storeBuilder := store.NewBuilder()
 	ksmMetricsRegistry := prometheus.NewRegistry()
-	storeBuilder.WithMetrics(ksmMetricsRegistry)
+	store.RegisterMetrics(ksmMetricsRegistry)
+
+	// Keep the options set by flags, settings removed from the config file
+	// on reload fall back to them.
+	flagOpts := opts
+	var configHash string
+	var configMetrics *configMetrics
+	if opts.ConfigFile != "" {
+		configMetrics = newConfigMetrics(ksmMetricsRegistry)
+		opts, configHash, err = loadConfig(opts.ConfigFile, flagOpts)
+		if err != nil {
+			klog.Fatalf("Failed to load config file: %v", err)
+		}
+		configMetrics.success(configHash)
+	}
 
-	var collectors = []string{"clonesets"}
-	if err := storeBuilder.WithEnabledResources(collectors); err != nil {
+	configure, err := newBuilderConfigurer(opts)
+	if err != nil {
 		klog.Fatalf("Failed to set up collectors: %v", err)
 	}
 
-	if len(opts.Namespaces) == 0 {
-		klog.Info("Using all namespace")
-		storeBuilder.WithNamespaces(options.DefaultNamespaces)
-	} else {
-		if opts.Namespaces.IsAllNamespaces() {
-			klog.Info("Using all namespace")
-		} else {
-			klog.Infof("Using %s namespaces", opts.Namespaces)
+	var fileSink *eventsink.FileSink
+	closers := []func() error{}
+	switch opts.EventSink {
+	case "", "kubernetes":
+	case "file":
+		fileSink, err = eventsink.NewFileSink(opts.EventLogFile)
+		if err != nil {
+			klog.Fatalf("Failed to open event log: %v", err)
 		}
-		storeBuilder.WithNamespaces(opts.Namespaces)
+		closers = append(closers, fileSink.Close)
+	default:
+		klog.Fatalf("Unsupported event sink %q", opts.EventSink)
 	}
 
-	whiteBlackList, err := whiteblacklist.New(opts.MetricWhitelist, opts.MetricBlacklist)
-	if err != nil {
-		klog.Fatal(err)
-	}
+	proc.StartReaper()
 
-	err = whiteBlackList.Parse()
+	clusterConfigs, err := loadClusterConfigs(opts)
 	if err != nil {
-		klog.Fatalf("error initializing the whiteblack list : %v", err)
+		klog.Fatalf("Failed to load cluster configs: %v", err)
 	}
 
-	storeBuilder.WithWhiteBlackList(whiteBlackList)
+	gatherers := prometheus.Gatherers{ksmMetricsRegistry}
+	clusters := []metricshandler.Cluster{}
+	var localClient kubernetes.Interface
 
-	proc.StartReaper()
+	for _, cc := range clusterConfigs {
+		kubeClient, err := clientset.NewForConfig(cc.config)
+		if err != nil {
+			panic(err)
+		}
+		coreClient, err := kubernetes.NewForConfig(cc.config)
+		if err != nil {
+			panic(err)
+		}
+		dynamicClient, err := dynamic.NewForConfig(cc.config)
+		if err != nil {
+			panic(err)
+		}
+		// Discovery gets its own client with a short timeout, so an
+		// unreachable cluster does not hold up the other clusters.
+		discoveryConfig := rest.CopyConfig(cc.config)
+		discoveryConfig.Timeout = opts.DiscoveryTimeout
+		discoveryClient, err := discovery.NewDiscoveryClientForConfig(discoveryConfig)
+		if err != nil {
+			panic(err)
+		}
 
-	config, err := clientcmd.BuildConfigFromFlags(opts.Apiserver, opts.Kubeconfig)
-	if err != nil {
-		panic(err)
+		// In single-cluster mode the self metrics of the builder go to the
+		// main registry, otherwise each cluster gets its own registry whose
+		// metrics are labeled with the cluster name.
+		registry := ksmMetricsRegistry
+		if cc.name == "" {
+			localClient = coreClient
+		} else {
+			registry = prometheus.NewRegistry()
+			gatherers = append(gatherers, clusterGatherer{cluster: cc.name, gatherer: registry})
+			klog.Infof("Watching cluster %s", cc.name)
+		}
+
+		storeBuilder := store.NewBuilder()
+		storeBuilder.WithCluster(cc.name)
+		storeBuilder.WithMetrics(registry)
+
+		if err := configure(storeBuilder); err != nil {
+			klog.Fatalf("Failed to set up collectors: %v", err)
+		}
+		storeBuilder.WithKubeClient(kubeClient)
+		storeBuilder.WithCoreClient(coreClient)
+		storeBuilder.WithDynamicClient(dynamicClient)
+		storeBuilder.WithDiscoveryClient(discoveryClient)
+
+		switch opts.EventSink {
+		case "file":
+			storeBuilder.WithEventSink(fileSink)
+		case "kubernetes":
+			sink := eventsink.NewKubernetesSink(coreClient)
+			closers = append(closers, sink.Close)
+			storeBuilder.WithEventSink(sink)
+		}
+
+		clusters = append(clusters, metricshandler.Cluster{Name: cc.name, Builder: storeBuilder})
 	}
-	kubeClient, err := clientset.NewForConfig(config)
-	if err != nil {
-		panic(err)
+
+	if localClient == nil && len(opts.Pod) > 0 && len(opts.Namespace) > 0 {
+		// Autosharding looks up the StatefulSet of this pod in the cluster
+		// it runs in, which is not necessarily one of the watched clusters.
+		config, err := clientcmd.BuildConfigFromFlags(opts.Apiserver, opts.Kubeconfig)
+		if err != nil {
+			klog.Fatalf("Failed to load config of the local cluster for autosharding: %v", err)
+		}
+		localClient, err = kubernetes.NewForConfig(config)
+		if err != nil {
+			panic(err)
+		}
 	}
 
-	storeBuilder.WithKubeClient(kubeClient)
 	ksmMetricsRegistry.MustRegister(
 		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
 		prometheus.NewGoCollector(),
 	)
-	go telemetryServer(ksmMetricsRegistry, opts.TelemetryHost, opts.TelemetryPort)
+	go telemetryServer(gatherers, opts.TelemetryHost, opts.TelemetryPort)
 
-	serveMetrics(ctx, kubeClient, storeBuilder, opts, opts.Host, opts.Port, opts.EnableGZIPEncoding)
+	encodings := opts.CompressionEncodings
+	if opts.EnableGZIPEncoding && !containsString(encodings, "gzip") {
+		encodings = append(encodings, "gzip")
+	}
+	for _, e := range encodings {
+		if !metricshandler.IsSupportedEncoding(e) {
+			klog.Fatalf("Unsupported compression encoding %q", e)
+		}
+	}
 
+	m := metricshandler.New(
+		opts,
+		localClient,
+		clusters,
+		encodings,
+	)
+	go func() {
+		if err := m.Run(ctx); err != nil && err != context.Canceled {
+			klog.Fatalf("Failed to run metrics handler: %v", err)
+		}
+	}()
+
+	if opts.ConfigFile != "" && opts.ConfigReloadInterval > 0 {
+		go watchConfig(ctx, m, configMetrics, opts.ConfigFile, opts.ConfigReloadInterval, flagOpts, configHash)
+	}
+
+	err = serveMetrics(ctx, m, opts.Host, opts.Port)
+	cancel()
+	for _, close := range closers {
+		if err := close(); err != nil {
+			klog.Errorf("Failed to close event sink: %v", err)
+		}
+	}
+	if err != nil {
+		klog.Fatal(err)
+	}
+	klog.Flush()
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
 }
 
 func telemetryServer(registry prometheus.Gatherer, host string, port int) {
@@ -138,7 +273,8 @@ func telemetryServer(registry prometheus.Gatherer, host string, port int) {
 	klog.Fatal(http.ListenAndServe(listenAddress, mux))
 }
 
-func serveMetrics(ctx context.Context, kubeClient clientset.Interface, storeBuilder *store.Builder, opts *options.Options, host string, port int, enableGZIPEncoding bool) {
+// serveMetrics serves the metrics of m until ctx is done.
+func serveMetrics(ctx context.Context, m *metricshandler.MetricsHandler, host string, port int) error {
 	// Address to listen on for web interface and telemetry
 	listenAddress := net.JoinHostPort(host, strconv.Itoa(port))
 
@@ -153,13 +289,6 @@ func serveMetrics(ctx context.Context, kubeClient clientset.Interface, storeBuil
 	mux.Handle("/debug/pprof/symbol", http.HandlerFunc(pprof.Symbol))
 	mux.Handle("/debug/pprof/trace", http.HandlerFunc(pprof.Trace))
 
-	m := metricshandler.New(
-		opts,
-		kubeClient,
-		storeBuilder,
-		enableGZIPEncoding,
-	)
-	go m.Run(ctx)
 	mux.Handle(metricsPath, m)
 
 	// Add healthzPath
@@ -167,6 +296,8 @@ func serveMetrics(ctx context.Context, kubeClient clientset.Interface, storeBuil
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte(http.StatusText(http.StatusOK)))
 	})
+	// Add readyzPath
+	mux.Handle(readyzPath, m.ReadyzHandler())
 	// Add index
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte(`<html>
@@ -176,9 +307,22 @@ func serveMetrics(ctx context.Context, kubeClient clientset.Interface, storeBuil
 			 <ul>
              <li><a href='` + metricsPath + `'>metrics</a></li>
              <li><a href='` + healthzPath + `'>healthz</a></li>
+             <li><a href='` + readyzPath + `'>readyz</a></li>
 			 </ul>
              </body>
              </html>`))
 	})
-	klog.Fatal(http.ListenAndServe(listenAddress, mux))
+	srv := &http.Server{Addr: listenAddress, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			klog.Errorf("Failed to shut down metrics server: %v", err)
+		}
+	}()
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
 }
@@ -0,0 +1,68 @@
+/*
+Copyright 2018 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package eventsink
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+
+	"k8s.io/klog"
+
+	"github.com/SchoIsles/kruise-state-metrics/internal/store"
+)
+
+// FileSink writes workload events as JSON lines.
+type FileSink struct {
+	mtx sync.Mutex
+	w   io.WriteCloser
+	enc *json.Encoder
+}
+
+// NewFileSink returns a FileSink appending to the file at path, creating it
+// if needed. A path of "-" writes to stdout.
+func NewFileSink(path string) (*FileSink, error) {
+	var w io.WriteCloser = os.Stdout
+	if path != "-" {
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, err
+		}
+		w = f
+	}
+	return &FileSink{w: w, enc: json.NewEncoder(w)}, nil
+}
+
+// Emit implements the store.EventSink interface.
+func (s *FileSink) Emit(e store.WorkloadEvent) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if err := s.enc.Encode(e); err != nil {
+		klog.Errorf("Failed to write %s event for %s %s/%s: %v", e.Reason, e.Kind, e.Namespace, e.Name, err)
+	}
+}
+
+// Close closes the underlying file.
+func (s *FileSink) Close() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.w == os.Stdout {
+		return nil
+	}
+	return s.w.Close()
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2018 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package eventsink
+
+import (
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog"
+
+	"github.com/SchoIsles/kruise-state-metrics/internal/store"
+	"github.com/SchoIsles/kruise-state-metrics/pkg/client/clientset/versioned/scheme"
+)
+
+// component is the source component of the events recorded by a
+// KubernetesSink.
+const component = "kruise-state-metrics"
+
+// KubernetesSink records workload events as core/v1 Events against the
+// workload.
+type KubernetesSink struct {
+	broadcaster record.EventBroadcaster
+	recorder    record.EventRecorder
+
+	// mtx protects closed, events emitted after Close are dropped.
+	mtx    sync.RWMutex
+	closed bool
+}
+
+// NewKubernetesSink returns a KubernetesSink creating Events through the
+// given client.
+func NewKubernetesSink(kubeClient kubernetes.Interface) *KubernetesSink {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: kubeClient.CoreV1().Events("")})
+
+	return &KubernetesSink{
+		broadcaster: broadcaster,
+		recorder:    broadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: component}),
+	}
+}
+
+// Emit implements the store.EventSink interface.
+func (s *KubernetesSink) Emit(e store.WorkloadEvent) {
+	if e.Object == nil {
+		klog.Warningf("Dropping %s event for %s %s/%s without object", e.Reason, e.Kind, e.Namespace, e.Name)
+		return
+	}
+
+	eventType := v1.EventTypeNormal
+	if e.Warning {
+		eventType = v1.EventTypeWarning
+	}
+
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	if s.closed {
+		return
+	}
+	s.recorder.Event(e.Object, eventType, e.Reason, e.Message)
+}
+
+// Close stops recording events.
+func (s *KubernetesSink) Close() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	s.broadcaster.Shutdown()
+	return nil
+}
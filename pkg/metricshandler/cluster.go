@@ -0,0 +1,172 @@
+/*
+Copyright 2018 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metricshandler
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+
+	"github.com/SchoIsles/kruise-state-metrics/internal/store"
+	metricsstore "k8s.io/kube-state-metrics/pkg/metrics_store"
+)
+
+// Cluster is a cluster whose Kruise workloads are exposed by a
+// MetricsHandler.
+type Cluster struct {
+	// Name is injected as cluster label into every sample. It is empty if a
+	// single cluster is exposed without a cluster label.
+	Name    string
+	Builder *store.Builder
+}
+
+// clusterStores holds the stores of the last Build of a cluster.
+type clusterStores struct {
+	Cluster
+	stores     []*metricsstore.MetricsStore
+	storeNames []string
+	// cancel stops the reflectors of the stores.
+	cancel func()
+}
+
+// build stops the reflectors of the current stores of the cluster and
+// replaces the stores with new ones built with the given sharding and
+// discovery.
+func (c *clusterStores) build(ctx context.Context, shard int32, totalShards int, d *store.Discovery) {
+	if c.cancel != nil {
+		c.cancel()
+	}
+	ctx, c.cancel = context.WithCancel(ctx)
+
+	c.Builder.WithSharding(shard, totalShards)
+	c.Builder.WithContext(ctx)
+	c.stores, c.storeNames = c.Builder.Build(d)
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+// injectClusterLabel returns a line rewrite function that adds the cluster
+// label as first label of every sample line.
+func injectClusterLabel(cluster string) func(line []byte) []byte {
+	label := []byte(store.ClusterLabel + `="` + labelValueEscaper.Replace(cluster) + `"`)
+
+	return func(line []byte) []byte {
+		if len(line) == 0 || line[0] == '#' || line[0] == '\n' {
+			return line
+		}
+
+		out := make([]byte, 0, len(line)+len(label)+3)
+		if i := bytes.IndexByte(line, '{'); i >= 0 {
+			out = append(out, line[:i+1]...)
+			out = append(out, label...)
+			if i+1 < len(line) && line[i+1] != '}' {
+				out = append(out, ',')
+			}
+			return append(out, line[i+1:]...)
+		}
+
+		i := bytes.IndexByte(line, ' ')
+		if i < 0 {
+			return line
+		}
+		out = append(out, line[:i]...)
+		out = append(out, '{')
+		out = append(out, label...)
+		out = append(out, '}')
+		return append(out, line[i:]...)
+	}
+}
+
+// writeLabeled writes the output of write to a buffer, injecting the cluster
+// label into every sample.
+func writeLabeled(cluster string, write func(w io.Writer)) []byte {
+	var buf bytes.Buffer
+	lw := newLineWriter(&buf, injectClusterLabel(cluster))
+	write(lw)
+	lw.Flush()
+	return buf.Bytes()
+}
+
+// family is a metric family of an exposition: its HELP and TYPE lines and
+// its samples.
+type family struct {
+	header  []byte
+	samples []byte
+	// headerFrom is the index of the exposition the header is taken from.
+	headerFrom int
+}
+
+// writeMergedFamilies writes the given expositions as one, with the samples
+// of each metric family grouped under a single HELP and TYPE header.
+func writeMergedFamilies(w io.Writer, expositions [][]byte) {
+	families := []*family{}
+	byName := map[string]*family{}
+
+	for n, exposition := range expositions {
+		var cur *family
+		for len(exposition) > 0 {
+			var line []byte
+			if i := bytes.IndexByte(exposition, '\n'); i >= 0 {
+				line, exposition = exposition[:i+1], exposition[i+1:]
+			} else {
+				// Terminate a trailing incomplete line, so it is not
+				// joined with the first line of the next family.
+				line, exposition = append(exposition[:len(exposition):len(exposition)], '\n'), nil
+			}
+
+			if name, ok := headerName(line); ok {
+				f, ok := byName[name]
+				if !ok {
+					f = &family{headerFrom: n}
+					byName[name] = f
+					families = append(families, f)
+				}
+				if f.headerFrom == n {
+					f.header = append(f.header, line...)
+				}
+				cur = f
+				continue
+			}
+
+			if cur == nil {
+				cur = &family{}
+				families = append(families, cur)
+			}
+			cur.samples = append(cur.samples, line...)
+		}
+	}
+
+	for _, f := range families {
+		w.Write(f.header)
+		w.Write(f.samples)
+	}
+}
+
+// headerName returns the metric name of a HELP or TYPE line.
+func headerName(line []byte) (string, bool) {
+	for _, prefix := range [][]byte{[]byte("# HELP "), []byte("# TYPE ")} {
+		if bytes.HasPrefix(line, prefix) {
+			rest := line[len(prefix):]
+			if i := bytes.IndexAny(rest, " \n"); i >= 0 {
+				rest = rest[:i]
+			}
+			return string(rest), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,204 @@
+/*
+Copyright 2018 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metricshandler
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	metricsstore "k8s.io/kube-state-metrics/pkg/metrics_store"
+)
+
+func TestInjectClusterLabel(t *testing.T) {
+	tests := []struct {
+		name    string
+		cluster string
+		line    string
+		want    string
+	}{
+		{
+			name:    "comment",
+			cluster: "a",
+			line:    "# HELP kube_cloneset_created Unix creation timestamp\n",
+			want:    "# HELP kube_cloneset_created Unix creation timestamp\n",
+		},
+		{
+			name:    "empty line",
+			cluster: "a",
+			line:    "\n",
+			want:    "\n",
+		},
+		{
+			name:    "labels",
+			cluster: "a",
+			line:    `kube_cloneset_created{namespace="ns",cloneset="x"} 1` + "\n",
+			want:    `kube_cloneset_created{cluster="a",namespace="ns",cloneset="x"} 1` + "\n",
+		},
+		{
+			name:    "special characters in values",
+			cluster: "a",
+			line:    `kube_cloneset_labels{label_x="{,\"}"} 1` + "\n",
+			want:    `kube_cloneset_labels{cluster="a",label_x="{,\"}"} 1` + "\n",
+		},
+		{
+			name:    "empty labels",
+			cluster: "a",
+			line:    "kube_x{} 1\n",
+			want:    `kube_x{cluster="a"} 1` + "\n",
+		},
+		{
+			name:    "no labels",
+			cluster: "a",
+			line:    "kube_x 1\n",
+			want:    `kube_x{cluster="a"} 1` + "\n",
+		},
+		{
+			name:    "escaped cluster name",
+			cluster: `a"b\c`,
+			line:    "kube_x 1\n",
+			want:    `kube_x{cluster="a\"b\\c"} 1` + "\n",
+		},
+		{
+			name:    "no value",
+			cluster: "a",
+			line:    "kube_x\n",
+			want:    "kube_x\n",
+		},
+		{
+			name:    "truncated labels",
+			cluster: "a",
+			line:    "kube_x{",
+			want:    `kube_x{cluster="a"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(injectClusterLabel(tt.cluster)([]byte(tt.line))); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteMergedFamilies(t *testing.T) {
+	const (
+		headerA = "# HELP kube_a A.\n# TYPE kube_a gauge\n"
+		headerB = "# HELP kube_b B.\n# TYPE kube_b gauge\n"
+	)
+
+	tests := []struct {
+		name        string
+		expositions []string
+		want        string
+	}{
+		{
+			name:        "nothing",
+			expositions: nil,
+			want:        "",
+		},
+		{
+			name: "same families",
+			expositions: []string{
+				headerA + "kube_a{cluster=\"x\"} 1\n" + headerB + "kube_b{cluster=\"x\"} 1\n",
+				headerA + "kube_a{cluster=\"y\"} 2\n" + headerB + "kube_b{cluster=\"y\"} 2\n",
+			},
+			want: headerA + "kube_a{cluster=\"x\"} 1\nkube_a{cluster=\"y\"} 2\n" +
+				headerB + "kube_b{cluster=\"x\"} 1\nkube_b{cluster=\"y\"} 2\n",
+		},
+		{
+			name: "family in one cluster only",
+			expositions: []string{
+				headerA + "kube_a{cluster=\"x\"} 1\n",
+				headerB + "kube_b{cluster=\"y\"} 2\n",
+			},
+			want: headerA + "kube_a{cluster=\"x\"} 1\n" + headerB + "kube_b{cluster=\"y\"} 2\n",
+		},
+		{
+			name: "family without samples in one cluster",
+			expositions: []string{
+				headerA,
+				headerA + "kube_a{cluster=\"y\"} 2\n",
+			},
+			want: headerA + "kube_a{cluster=\"y\"} 2\n",
+		},
+		{
+			name: "missing trailing newline",
+			expositions: []string{
+				headerA + "kube_a{cluster=\"x\"} 1",
+				headerA + "kube_a{cluster=\"y\"} 2",
+			},
+			want: headerA + "kube_a{cluster=\"x\"} 1\nkube_a{cluster=\"y\"} 2\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expositions := make([][]byte, 0, len(tt.expositions))
+			for _, e := range tt.expositions {
+				expositions = append(expositions, []byte(e))
+			}
+			var buf bytes.Buffer
+			writeMergedFamilies(&buf, expositions)
+			if got := buf.String(); got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteLabeled(t *testing.T) {
+	got := string(writeLabeled("x", func(w io.Writer) {
+		io.WriteString(w, "# TYPE kube_a gauge\nkube_a{namespace=\"ns\"} 1\nkube_a 2")
+	}))
+	want := "# TYPE kube_a gauge\nkube_a{cluster=\"x\",namespace=\"ns\"} 1\nkube_a{cluster=\"x\"} 2\n"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestServeHTTPClusters(t *testing.T) {
+	m := newTestHandler(nil,
+		clusterStores{
+			Cluster: Cluster{Name: "x"},
+			stores: []*metricsstore.MetricsStore{
+				newTestStore(t, "kube_cloneset_created", "ns/a"),
+				newTestStore(t, "kube_sidecarset_created", "ns/s"),
+			},
+			storeNames: []string{"clonesets", "sidecarsets"},
+		},
+		clusterStores{
+			Cluster: Cluster{Name: "y"},
+			stores: []*metricsstore.MetricsStore{
+				newTestStore(t, "kube_cloneset_created", "ns/b"),
+			},
+			storeNames: []string{"clonesets"},
+		},
+	)
+
+	want := "# HELP kube_cloneset_created Test family.\n" +
+		"# TYPE kube_cloneset_created gauge\n" +
+		"kube_cloneset_created{cluster=\"x\",namespace=\"ns\",name=\"a\"} 1\n" +
+		"kube_cloneset_created{cluster=\"y\",namespace=\"ns\",name=\"b\"} 1\n" +
+		"# HELP kube_sidecarset_created Test family.\n" +
+		"# TYPE kube_sidecarset_created gauge\n" +
+		"kube_sidecarset_created{cluster=\"x\",namespace=\"ns\",name=\"s\"} 1\n"
+	if got := scrape(m, "/metrics", nil).Body.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
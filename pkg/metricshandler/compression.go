@@ -0,0 +1,116 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metricshandler
+
+import (
+	"compress/gzip"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// encoder is a resettable compressing writer for a single Content-Encoding.
+type encoder interface {
+	io.WriteCloser
+	Reset(w io.Writer)
+}
+
+// encoderPools holds one pool of encoders per supported Content-Encoding, so
+// that large scrapes do not allocate a new compressor every time.
+var encoderPools = map[string]*sync.Pool{
+	"gzip": {
+		New: func() interface{} { return gzip.NewWriter(nil) },
+	},
+	"zstd": {
+		New: func() interface{} {
+			// NewWriter only fails on invalid options.
+			w, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+			return w
+		},
+	},
+	"snappy": {
+		New: func() interface{} { return snappy.NewBufferedWriter(nil) },
+	},
+}
+
+// IsSupportedEncoding returns whether the given Content-Encoding can be used
+// to compress responses.
+func IsSupportedEncoding(name string) bool {
+	_, ok := encoderPools[name]
+	return ok
+}
+
+// negotiateEncoding picks the encoding to use for a request with the given
+// Accept-Encoding header value. Encodings are chosen by the client's q-value,
+// ties are broken by the order of enabled. An empty string means the response
+// must not be compressed.
+func negotiateEncoding(acceptEncoding string, enabled []string) string {
+	if acceptEncoding == "" {
+		return ""
+	}
+
+	accepted := map[string]float64{}
+	wildcard := -1.0
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, q := parseQuality(part)
+		if name == "" {
+			continue
+		}
+		if name == "*" {
+			wildcard = q
+			continue
+		}
+		accepted[name] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, e := range enabled {
+		q, ok := accepted[e]
+		if !ok {
+			q = wildcard
+		}
+		if q > bestQ {
+			best, bestQ = e, q
+		}
+	}
+	return best
+}
+
+// parseQuality parses a single Accept or Accept-Encoding element such as
+// "gzip;q=0.8". Elements without a q-value have a quality of 1.
+func parseQuality(part string) (string, float64) {
+	params := strings.Split(part, ";")
+	name := strings.ToLower(strings.TrimSpace(params[0]))
+	q := 1.0
+
+	for _, p := range params[1:] {
+		p = strings.TrimSpace(p)
+		if !strings.HasPrefix(p, "q=") {
+			continue
+		}
+		v, err := strconv.ParseFloat(strings.TrimPrefix(p, "q="), 64)
+		if err != nil {
+			return "", 0
+		}
+		q = v
+	}
+	return name, q
+}
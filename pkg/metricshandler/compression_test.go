@@ -0,0 +1,185 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metricshandler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+	metricsstore "k8s.io/kube-state-metrics/pkg/metrics_store"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	enabled := []string{"zstd", "gzip"}
+
+	tests := []struct {
+		acceptEncoding string
+		want           string
+	}{
+		{acceptEncoding: "", want: ""},
+		{acceptEncoding: "identity", want: ""},
+		{acceptEncoding: "gzip", want: "gzip"},
+		{acceptEncoding: "GZIP", want: "gzip"},
+		{acceptEncoding: "gzip, deflate, br", want: "gzip"},
+		{acceptEncoding: "gzip, zstd", want: "zstd"},
+		{acceptEncoding: "gzip;q=1.0, zstd;q=0.5", want: "gzip"},
+		{acceptEncoding: "gzip ; q=0.5 , zstd ; q=0.8", want: "zstd"},
+		{acceptEncoding: "gzip;q=0", want: ""},
+		{acceptEncoding: "zstd;q=0, gzip;q=0.1", want: "gzip"},
+		{acceptEncoding: "*", want: "zstd"},
+		{acceptEncoding: "*;q=0", want: ""},
+		{acceptEncoding: "zstd;q=0, *", want: "gzip"},
+		{acceptEncoding: "*;q=0.5, gzip", want: "gzip"},
+		{acceptEncoding: "gzip;q=invalid", want: ""},
+		{acceptEncoding: "snappy", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.acceptEncoding, func(t *testing.T) {
+			if got := negotiateEncoding(tt.acceptEncoding, enabled); got != tt.want {
+				t.Errorf("negotiateEncoding(%q) = %q, want %q", tt.acceptEncoding, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseQuality(t *testing.T) {
+	tests := []struct {
+		part     string
+		wantName string
+		wantQ    float64
+	}{
+		{part: "gzip", wantName: "gzip", wantQ: 1},
+		{part: " Gzip ", wantName: "gzip", wantQ: 1},
+		{part: "gzip;q=0.5", wantName: "gzip", wantQ: 0.5},
+		{part: "gzip;q=0", wantName: "gzip", wantQ: 0},
+		{part: "text/plain;version=0.0.4;q=0.3", wantName: "text/plain", wantQ: 0.3},
+		{part: "gzip;q=", wantName: "", wantQ: 0},
+		{part: "", wantName: "", wantQ: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.part, func(t *testing.T) {
+			name, q := parseQuality(tt.part)
+			if name != tt.wantName || q != tt.wantQ {
+				t.Errorf("parseQuality(%q) = %q, %v, want %q, %v", tt.part, name, q, tt.wantName, tt.wantQ)
+			}
+		})
+	}
+}
+
+func decoderFor(t *testing.T, encoding string, r io.Reader) io.Reader {
+	switch encoding {
+	case "gzip":
+		d, err := gzip.NewReader(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	case "zstd":
+		d, err := zstd.NewReader(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	case "snappy":
+		return snappy.NewReader(r)
+	}
+	t.Fatalf("unknown encoding %s", encoding)
+	return nil
+}
+
+func TestEncoderPools(t *testing.T) {
+	for encoding, pool := range encoderPools {
+		t.Run(encoding, func(t *testing.T) {
+			// Encoders are reused across responses, the second round gets
+			// the encoder put back by the first.
+			for i, want := range []string{"first response\n", strings.Repeat("second response\n", 1000)} {
+				var buf bytes.Buffer
+				enc := pool.Get().(encoder)
+				enc.Reset(&buf)
+				if _, err := io.WriteString(enc, want); err != nil {
+					t.Fatal(err)
+				}
+				if err := enc.Close(); err != nil {
+					t.Fatal(err)
+				}
+				pool.Put(enc)
+
+				got, err := ioutil.ReadAll(decoderFor(t, encoding, &buf))
+				if err != nil {
+					t.Fatalf("round %d: %v", i, err)
+				}
+				if string(got) != want {
+					t.Errorf("round %d: got %d bytes, want %d", i, len(got), len(want))
+				}
+			}
+		})
+	}
+}
+
+func TestServeHTTPCompression(t *testing.T) {
+	m := newTestHandler([]string{"zstd", "gzip", "snappy"}, clusterStores{
+		stores:     []*metricsstore.MetricsStore{newTestStore(t, "kube_cloneset_created", "ns/a")},
+		storeNames: []string{"clonesets"},
+	})
+	want := scrape(m, "/metrics", nil).Body.String()
+
+	tests := []struct {
+		acceptEncoding string
+		wantEncoding   string
+	}{
+		{acceptEncoding: "", wantEncoding: ""},
+		{acceptEncoding: "gzip", wantEncoding: "gzip"},
+		{acceptEncoding: "gzip, zstd", wantEncoding: "zstd"},
+		{acceptEncoding: "snappy, zstd;q=0", wantEncoding: "snappy"},
+		{acceptEncoding: "gzip;q=0", wantEncoding: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.acceptEncoding, func(t *testing.T) {
+			// Scrape twice to use pooled encoders.
+			for i := 0; i < 2; i++ {
+				w := scrape(m, "/metrics", http.Header{"Accept-Encoding": {tt.acceptEncoding}})
+				if got := w.Header().Get("Content-Encoding"); got != tt.wantEncoding {
+					t.Fatalf("Content-Encoding = %q, want %q", got, tt.wantEncoding)
+				}
+				if got := w.Header().Get("Vary"); got != "Accept-Encoding" {
+					t.Errorf("Vary = %q, want Accept-Encoding", got)
+				}
+				var body io.Reader = w.Body
+				if tt.wantEncoding != "" {
+					body = decoderFor(t, tt.wantEncoding, body)
+				}
+				got, err := ioutil.ReadAll(body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(got) != want {
+					t.Errorf("got:\n%s\nwant:\n%s", got, want)
+				}
+			}
+		})
+	}
+}
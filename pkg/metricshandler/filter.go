@@ -0,0 +1,93 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metricshandler
+
+import (
+	"bytes"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// scrapeFilter selects the collectors and namespaces written for a single
+// scrape, e.g. /metrics?collectors=clonesets,statefulsets&namespace=team-a.
+// Empty sets select everything.
+type scrapeFilter struct {
+	collectors map[string]struct{}
+	namespaces map[string]struct{}
+}
+
+// parseScrapeFilter parses the collectors and namespace query parameters. Both
+// accept comma-separated lists and can be repeated. Collectors must be one of
+// known, which is sorted.
+func parseScrapeFilter(query url.Values, known []string) (scrapeFilter, error) {
+	f := scrapeFilter{
+		collectors: splitQueryValues(query["collectors"]),
+		namespaces: splitQueryValues(query["namespace"]),
+	}
+
+	for c := range f.collectors {
+		if i := sort.SearchStrings(known, c); i == len(known) || known[i] != c {
+			return scrapeFilter{}, errors.Errorf("collector %s does not exist. Available collectors: %s", c, strings.Join(known, ","))
+		}
+	}
+	return f, nil
+}
+
+func splitQueryValues(values []string) map[string]struct{} {
+	set := map[string]struct{}{}
+	for _, v := range values {
+		for _, s := range strings.Split(v, ",") {
+			s = strings.TrimSpace(s)
+			if s != "" {
+				set[s] = struct{}{}
+			}
+		}
+	}
+	return set
+}
+
+func (f scrapeFilter) includesCollector(name string) bool {
+	if len(f.collectors) == 0 {
+		return true
+	}
+	_, ok := f.collectors[name]
+	return ok
+}
+
+func (f scrapeFilter) filtersNamespaces() bool {
+	return len(f.namespaces) > 0
+}
+
+// filterLine drops samples outside of the selected namespaces, including
+// samples of cluster-scoped objects, which have no namespace label.
+func (f scrapeFilter) filterLine(line []byte) []byte {
+	if bytes.HasPrefix(line, []byte("#")) {
+		return line
+	}
+
+	ns, ok := labelValue(line, "namespace")
+	if !ok {
+		return nil
+	}
+	if _, ok := f.namespaces[string(ns)]; !ok {
+		return nil
+	}
+	return line
+}
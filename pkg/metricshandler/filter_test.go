@@ -0,0 +1,106 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metricshandler
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestParseScrapeFilter(t *testing.T) {
+	known := []string{"clonesets", "imagepulljobs", "statefulsets"}
+
+	tests := []struct {
+		query          string
+		wantCollectors []string
+		wantNamespaces []string
+		wantErr        bool
+	}{
+		{query: ""},
+		{query: "collectors=clonesets", wantCollectors: []string{"clonesets"}},
+		{query: "collectors=clonesets,imagepulljobs&collectors=statefulsets", wantCollectors: []string{"clonesets", "imagepulljobs", "statefulsets"}},
+		{query: "collectors=%20clonesets%20,,", wantCollectors: []string{"clonesets"}},
+		{query: "namespace=a,b&namespace=c", wantNamespaces: []string{"a", "b", "c"}},
+		{query: "collectors=unknown", wantErr: true},
+		{query: "collectors=clone", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			query, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f, err := parseScrapeFilter(query, known)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseScrapeFilter() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := setOf(tt.wantCollectors); !reflect.DeepEqual(f.collectors, got) {
+				t.Errorf("collectors = %v, want %v", f.collectors, got)
+			}
+			if got := setOf(tt.wantNamespaces); !reflect.DeepEqual(f.namespaces, got) {
+				t.Errorf("namespaces = %v, want %v", f.namespaces, got)
+			}
+		})
+	}
+}
+
+func setOf(values []string) map[string]struct{} {
+	set := map[string]struct{}{}
+	for _, v := range values {
+		set[v] = struct{}{}
+	}
+	return set
+}
+
+func TestFilterLine(t *testing.T) {
+	f := scrapeFilter{namespaces: setOf([]string{"a", "b"})}
+
+	tests := []struct {
+		name string
+		line string
+		keep bool
+	}{
+		{name: "help", line: "# HELP kube_cloneset_created Unix creation timestamp\n", keep: true},
+		{name: "type", line: "# TYPE kube_cloneset_created gauge\n", keep: true},
+		{name: "selected namespace", line: `kube_cloneset_created{namespace="a",cloneset="x"} 1` + "\n", keep: true},
+		{name: "other namespace", line: `kube_cloneset_created{namespace="c",cloneset="x"} 1` + "\n", keep: false},
+		{name: "namespace not first", line: `kube_cloneset_created{cloneset="x",namespace="b"} 1` + "\n", keep: true},
+		{name: "cluster-scoped", line: `kube_sidecarset_created{sidecarset="x"} 1` + "\n", keep: false},
+		{name: "no labels", line: "kube_sidecarset_created 1\n", keep: false},
+		{name: "namespace in a value", line: `kube_sidecarset_created{sidecarset="namespace=\"a\""} 1` + "\n", keep: false},
+		{name: "similar label name", line: `kube_cloneset_labels{label_namespace="a",namespace="c"} 1` + "\n", keep: false},
+		{name: "special characters", line: `kube_cloneset_labels{label_x="{,}",namespace="a"} 1` + "\n", keep: true},
+		{name: "unparseable", line: `kube_cloneset_created{namespace=a} 1` + "\n", keep: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := f.filterLine([]byte(tt.line))
+			if tt.keep && string(got) != tt.line {
+				t.Errorf("expected line to be kept, got %q", got)
+			}
+			if !tt.keep && got != nil {
+				t.Errorf("expected line to be dropped, got %q", got)
+			}
+		})
+	}
+}
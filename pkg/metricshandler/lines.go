@@ -0,0 +1,153 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metricshandler
+
+import (
+	"bytes"
+	"io"
+)
+
+// lineWriter passes every complete line written to it through rewrite before
+// writing it to w. Lines for which rewrite returns nil are dropped.
+type lineWriter struct {
+	w       io.Writer
+	rewrite func(line []byte) []byte
+	// buf holds an incomplete line until its newline is written.
+	buf []byte
+}
+
+func newLineWriter(w io.Writer, rewrite func(line []byte) []byte) *lineWriter {
+	return &lineWriter{w: w, rewrite: rewrite}
+}
+
+func (l *lineWriter) Write(p []byte) (int, error) {
+	l.buf = append(l.buf, p...)
+
+	for {
+		i := bytes.IndexByte(l.buf, '\n')
+		if i < 0 {
+			break
+		}
+		if err := l.writeLine(l.buf[:i+1]); err != nil {
+			return 0, err
+		}
+		l.buf = l.buf[i+1:]
+	}
+
+	return len(p), nil
+}
+
+// Flush writes a trailing incomplete line, if any. It does not close the
+// underlying writer.
+func (l *lineWriter) Flush() error {
+	if len(l.buf) == 0 {
+		return nil
+	}
+	err := l.writeLine(append(l.buf, '\n'))
+	l.buf = nil
+	return err
+}
+
+func (l *lineWriter) writeLine(line []byte) error {
+	out := l.rewrite(line)
+	if out == nil {
+		return nil
+	}
+	_, err := l.w.Write(out)
+	return err
+}
+
+// labelSpan holds the offsets of a single label of a sample line. The value
+// offsets exclude the surrounding quotes.
+type labelSpan struct {
+	keyStart, keyEnd     int
+	valueStart, valueEnd int
+}
+
+// parseLabels returns the labels of a sample line in the text exposition
+// format, taking care of escaped quotes in label values.
+func parseLabels(line []byte) ([]labelSpan, bool) {
+	start := bytes.IndexByte(line, '{')
+	if start < 0 {
+		return nil, true
+	}
+
+	spans := []labelSpan{}
+	i := start + 1
+	for i < len(line) && line[i] != '}' {
+		eq := bytes.IndexByte(line[i:], '=')
+		if eq < 0 || i+eq+1 >= len(line) || line[i+eq+1] != '"' {
+			return nil, false
+		}
+		span := labelSpan{keyStart: i, keyEnd: i + eq, valueStart: i + eq + 2}
+
+		end := span.valueStart
+		for end < len(line) && line[end] != '"' {
+			if line[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(line) {
+			return nil, false
+		}
+		span.valueEnd = end
+		spans = append(spans, span)
+
+		i = end + 1
+		if i < len(line) && line[i] == ',' {
+			i++
+		}
+	}
+
+	return spans, true
+}
+
+// labelValue returns the raw, still escaped, value of the given label of a
+// sample line.
+func labelValue(line []byte, key string) ([]byte, bool) {
+	spans, ok := parseLabels(line)
+	if !ok {
+		return nil, false
+	}
+	for _, s := range spans {
+		if string(line[s.keyStart:s.keyEnd]) == key {
+			return line[s.valueStart:s.valueEnd], true
+		}
+	}
+	return nil, false
+}
+
+// renameLabel renames the label from to the label to in a single sample line.
+func renameLabel(line []byte, from, to string) []byte {
+	spans, ok := parseLabels(line)
+	if !ok {
+		return line
+	}
+
+	out := make([]byte, 0, len(line)+len(to))
+	last := 0
+	for _, s := range spans {
+		if string(line[s.keyStart:s.keyEnd]) != from {
+			continue
+		}
+		out = append(out, line[last:s.keyStart]...)
+		out = append(out, to...)
+		last = s.keyEnd
+	}
+	return append(out, line[last:]...)
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metricshandler
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestLineWriter(t *testing.T) {
+	// dropB drops every line starting with b and upper-cases the others.
+	dropB := func(line []byte) []byte {
+		if bytes.HasPrefix(line, []byte("b")) {
+			return nil
+		}
+		return bytes.ToUpper(line)
+	}
+
+	tests := []struct {
+		name   string
+		writes []string
+		want   string
+	}{
+		{name: "nothing", writes: nil, want: ""},
+		{name: "one line per write", writes: []string{"a\n", "b\n", "c\n"}, want: "A\nC\n"},
+		{name: "lines split across writes", writes: []string{"a", "a\nb", "b\nc", "c\n"}, want: "AA\nCC\n"},
+		{name: "several lines per write", writes: []string{"a\nb\nc\n"}, want: "A\nC\n"},
+		{name: "missing trailing newline", writes: []string{"a\nc"}, want: "A\nC\n"},
+		{name: "empty lines", writes: []string{"\n\na\n"}, want: "\n\nA\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := newLineWriter(&buf, dropB)
+			for _, s := range tt.writes {
+				if n, err := w.Write([]byte(s)); err != nil || n != len(s) {
+					t.Fatalf("Write(%q) = %d, %v", s, n, err)
+				}
+			}
+			if err := w.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseLabels(t *testing.T) {
+	tests := []struct {
+		line   string
+		want   map[string]string
+		wantOK bool
+	}{
+		{line: "kube_x 1\n", want: map[string]string{}, wantOK: true},
+		{line: "kube_x{} 1\n", want: map[string]string{}, wantOK: true},
+		{line: `kube_x{a="1",b="2"} 1` + "\n", want: map[string]string{"a": "1", "b": "2"}, wantOK: true},
+		{line: `kube_x{a="{,}",b="x=\"y\""} 1` + "\n", want: map[string]string{"a": "{,}", "b": `x=\"y\"`}, wantOK: true},
+		{line: `kube_x{a="\\",b="2"} 1` + "\n", want: map[string]string{"a": `\\`, "b": "2"}, wantOK: true},
+		{line: `kube_x{a="1",} 1` + "\n", want: map[string]string{"a": "1"}, wantOK: true},
+		{line: `kube_x{a=1} 1` + "\n", wantOK: false},
+		{line: `kube_x{a="1} 1` + "\n", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			line := []byte(tt.line)
+			spans, ok := parseLabels(line)
+			if ok != tt.wantOK {
+				t.Fatalf("parseLabels() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			got := map[string]string{}
+			for _, s := range spans {
+				got[string(line[s.keyStart:s.keyEnd])] = string(line[s.valueStart:s.valueEnd])
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got labels %v, want %v", got, tt.want)
+			}
+			for k, v := range tt.want {
+				if got[k] != v {
+					t.Errorf("got labels %v, want %v", got, tt.want)
+				}
+				if value, ok := labelValue(line, k); !ok || string(value) != v {
+					t.Errorf("labelValue(%q) = %q, %v, want %q", k, value, ok, v)
+				}
+			}
+		})
+	}
+}
+
+func TestRenameLabel(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want string
+	}{
+		{
+			name: "renamed",
+			line: `kube_x{a="1",status="true"} 1` + "\n",
+			want: `kube_x{a="1",kube_x="true"} 1` + "\n",
+		},
+		{
+			name: "label name in a value",
+			line: `kube_x{a="status=\"x\"",status="true"} 1` + "\n",
+			want: `kube_x{a="status=\"x\"",kube_x="true"} 1` + "\n",
+		},
+		{
+			name: "missing",
+			line: `kube_x{a="1"} 1` + "\n",
+			want: `kube_x{a="1"} 1` + "\n",
+		},
+		{
+			name: "no labels",
+			line: "kube_x 1\n",
+			want: "kube_x 1\n",
+		},
+		{
+			name: "unparseable",
+			line: `kube_x{status=true} 1` + "\n",
+			want: `kube_x{status=true} 1` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(renameLabel([]byte(tt.line), "status", "kube_x")); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
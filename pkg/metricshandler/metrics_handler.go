@@ -17,65 +17,142 @@ limitations under the License.
 package metricshandler
 
 import (
-	"compress/gzip"
 	"context"
 	"io"
 	"net/http"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
-	clientset "github.com/SchoIsles/kruise-state-metrics/pkg/client/clientset/versioned"
+	"github.com/pkg/errors"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/klog"
 
 	"github.com/SchoIsles/kruise-state-metrics/internal/store"
-	metricsstore "k8s.io/kube-state-metrics/pkg/metrics_store"
-	"k8s.io/kube-state-metrics/pkg/options"
+	"github.com/SchoIsles/kruise-state-metrics/pkg/options"
 )
 
 // MetricsHandler is a http.Handler that exposes the main kube-state-metrics
 // /metrics endpoint. It allows concurrent reconfiguration at runtime.
 type MetricsHandler struct {
-	opts               *options.Options
-	kubeClient         clientset.Interface
-	storeBuilder       *store.Builder
-	enableGZIPEncoding bool
+	opts       *options.Options
+	kubeClient kubernetes.Interface
+	encodings  []string
 
-	cancel func()
-
-	// mtx protects stores, curShard, and curTotalShards
-	mtx            *sync.RWMutex
-	stores         []*metricsstore.MetricsStore
+	// mtx protects clusters, shard, totalShards, curShard, and
+	// curTotalShards
+	mtx      *sync.RWMutex
+	clusters []*clusterStores
+	// shard and totalShards are the configured sharding, used unless
+	// autosharding is enabled.
+	shard          int32
+	totalShards    int
 	curShard       int32
 	curTotalShards int
 }
 
-// New creates and returns a new MetricsHandler with the given options.
-func New(opts *options.Options, kubeClient clientset.Interface, storeBuilder *store.Builder, enableGZIPEncoding bool) *MetricsHandler {
+// New creates and returns a new MetricsHandler with the given options,
+// exposing the stores of every given cluster. kubeClient is used for
+// autosharding and must point to the cluster the handler runs in.
+// Responses are compressed with the first of encodings, in order of
+// preference, that the client accepts.
+func New(opts *options.Options, kubeClient kubernetes.Interface, clusters []Cluster, encodings []string) *MetricsHandler {
+	cs := make([]*clusterStores, 0, len(clusters))
+	for _, c := range clusters {
+		cs = append(cs, &clusterStores{Cluster: c})
+	}
 	return &MetricsHandler{
-		opts:               opts,
-		kubeClient:         kubeClient,
-		storeBuilder:       storeBuilder,
-		enableGZIPEncoding: enableGZIPEncoding,
-		mtx:                &sync.RWMutex{},
+		opts:        opts,
+		kubeClient:  kubeClient,
+		clusters:    cs,
+		encodings:   encodings,
+		mtx:         &sync.RWMutex{},
+		shard:       opts.Shard,
+		totalShards: opts.TotalShards,
 	}
 }
 
 // ConfigureSharding (re-)configures sharding. Re-configuration can be done
 // concurrently.
 func (m *MetricsHandler) ConfigureSharding(ctx context.Context, shard int32, totalShards int) {
+	discoveries := m.discover()
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	m.buildLocked(ctx, shard, totalShards, discoveries)
+}
+
+// Reconfigure applies configure to the store builder of every cluster and
+// rebuilds the stores. Unless autosharding is enabled, the stores are sharded
+// with the given shard and totalShards from now on. If the stores were not
+// built yet, they are only built by Run.
+func (m *MetricsHandler) Reconfigure(ctx context.Context, configure func(b *store.Builder) error, shard int32, totalShards int) error {
+	m.mtx.Lock()
+	for _, c := range m.clusters {
+		if err := configure(c.Builder); err != nil {
+			m.mtx.Unlock()
+			return errors.Wrapf(err, "configure cluster %q", c.Name)
+		}
+	}
+	m.shard, m.totalShards = shard, totalShards
+	built := m.curTotalShards > 0
+	m.mtx.Unlock()
+
+	if !built {
+		return nil
+	}
+
+	// The configuration decides which group versions are discovered, so
+	// discovery runs after applying it, without holding the lock.
+	discoveries := m.discover()
+
 	m.mtx.Lock()
 	defer m.mtx.Unlock()
 
-	if m.cancel != nil {
-		m.cancel()
+	if m.autoSharding() {
+		shard, totalShards = m.curShard, m.curTotalShards
 	}
+	m.buildLocked(ctx, shard, totalShards, discoveries)
+	return nil
+}
+
+// discover runs API discovery for every cluster concurrently. It must be
+// called without holding m.mtx, as discovery of an unreachable cluster only
+// returns after the discovery timeout.
+func (m *MetricsHandler) discover() []*store.Discovery {
+	discoveries := make([]*store.Discovery, len(m.clusters))
+
+	var wg sync.WaitGroup
+	for i, c := range m.clusters {
+		wg.Add(1)
+		go func(i int, b *store.Builder) {
+			defer wg.Done()
+			discoveries[i] = b.Discover()
+		}(i, c.Builder)
+	}
+	wg.Wait()
+
+	return discoveries
+}
+
+// buildLocked rebuilds the stores of every cluster with the given sharding
+// and discoveries. m.mtx must be held for writing.
+func (m *MetricsHandler) buildLocked(ctx context.Context, shard int32, totalShards int, discoveries []*store.Discovery) {
 	if totalShards != 1 {
 		klog.Infof("configuring sharding of this instance to be shard index %d (zero-indexed) out of %d total shards", shard, totalShards)
 	}
-	ctx, m.cancel = context.WithCancel(ctx)
-	m.storeBuilder.WithSharding(shard, totalShards)
-	m.storeBuilder.WithContext(ctx)
-	m.stores = m.storeBuilder.Build()
+	for i, c := range m.clusters {
+		c.build(ctx, shard, totalShards, discoveries[i])
+	}
 	m.curShard = shard
 	m.curTotalShards = totalShards
 }
@@ -84,49 +161,340 @@ func (m *MetricsHandler) ConfigureSharding(ctx context.Context, shard int32, tot
 // re-configures sharding on re-sharding events. Run should only be called
 // once.
 func (m *MetricsHandler) Run(ctx context.Context) error {
-	autoSharding := len(m.opts.Pod) > 0 && len(m.opts.Namespace) > 0
+	if m.opts.DiscoveryInterval > 0 {
+		go m.runDiscovery(ctx, m.opts.DiscoveryInterval)
+	}
 
-	if !autoSharding {
+	if !m.autoSharding() {
 		klog.Info("Autosharding disabled")
-		m.ConfigureSharding(ctx, m.opts.Shard, m.opts.TotalShards)
+		m.mtx.RLock()
+		shard, totalShards := m.shard, m.totalShards
+		m.mtx.RUnlock()
+		m.ConfigureSharding(ctx, shard, totalShards)
 		<-ctx.Done()
 		return ctx.Err()
 	}
 
+	klog.Infof("Autosharding enabled with pod=%v pod_namespace=%v", m.opts.Pod, m.opts.Namespace)
+	klog.Infof("Auto detecting sharding settings.")
+	ss, err := detectStatefulSet(m.kubeClient, m.opts.Pod, m.opts.Namespace)
+	if err != nil {
+		return errors.Wrap(err, "detect StatefulSet")
+	}
+	statefulSetName := ss.Name
+
+	fieldSelector := fields.OneTermEqualSelector("metadata.name", statefulSetName).String()
+
+	i := cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				options.FieldSelector = fieldSelector
+				return m.kubeClient.AppsV1().StatefulSets(m.opts.Namespace).List(options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				options.FieldSelector = fieldSelector
+				return m.kubeClient.AppsV1().StatefulSets(m.opts.Namespace).Watch(options)
+			},
+		}, &appsv1.StatefulSet{}, 0, cache.Indexers{},
+	)
+	i.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(o interface{}) {
+			ss := o.(*appsv1.StatefulSet)
+			if ss.Name != statefulSetName {
+				return
+			}
+
+			shard, totalShards, err := shardingSettingsFromStatefulSet(ss, m.opts.Pod)
+			if err != nil {
+				klog.Errorf("detect sharding settings from StatefulSet: %v", err)
+				return
+			}
+
+			m.mtx.RLock()
+			shardingUnchanged := m.curShard == shard && m.curTotalShards == totalShards
+			m.mtx.RUnlock()
+
+			if shardingUnchanged {
+				return
+			}
+
+			m.ConfigureSharding(ctx, shard, totalShards)
+		},
+		UpdateFunc: func(oldo, curo interface{}) {
+			old := oldo.(*appsv1.StatefulSet)
+			cur := curo.(*appsv1.StatefulSet)
+			if cur.Name != statefulSetName {
+				return
+			}
+
+			if old.ResourceVersion == cur.ResourceVersion {
+				return
+			}
+
+			shard, totalShards, err := shardingSettingsFromStatefulSet(cur, m.opts.Pod)
+			if err != nil {
+				klog.Errorf("detect sharding settings from StatefulSet: %v", err)
+				return
+			}
+
+			m.mtx.RLock()
+			shardingUnchanged := m.curShard == shard && m.curTotalShards == totalShards
+			m.mtx.RUnlock()
+
+			if shardingUnchanged {
+				return
+			}
+
+			m.ConfigureSharding(ctx, shard, totalShards)
+		},
+	})
+	go i.Run(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), i.HasSynced) {
+		return errors.New("waiting for informer cache to sync failed")
+	}
 	<-ctx.Done()
 	return ctx.Err()
 }
 
+// autoSharding reports whether sharding is detected from the StatefulSet of
+// the pod the handler runs in.
+func (m *MetricsHandler) autoSharding() bool {
+	return len(m.opts.Pod) > 0 && len(m.opts.Namespace) > 0
+}
+
+// runDiscovery periodically checks whether the set of served resources of a
+// cluster changed and rebuilds the stores of that cluster with the current
+// sharding if it did.
+func (m *MetricsHandler) runDiscovery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		discoveries := m.discover()
+
+		m.mtx.RLock()
+		// Sharding not configured yet, the first build runs discovery anyway.
+		configured := m.curTotalShards > 0
+		changed := []int{}
+		for i, c := range m.clusters {
+			if configured && c.Builder.ActiveResourcesChanged(discoveries[i]) {
+				changed = append(changed, i)
+			}
+		}
+		m.mtx.RUnlock()
+
+		if len(changed) == 0 {
+			continue
+		}
+
+		m.mtx.Lock()
+		for _, i := range changed {
+			c := m.clusters[i]
+			klog.Infof("Served resources of cluster %q changed, rebuilding its stores", c.Name)
+			c.build(ctx, m.curShard, m.curTotalShards, discoveries[i])
+		}
+		m.mtx.Unlock()
+	}
+}
+
 // ServeHTTP implements the http.Handler interface. It writes the metrics in
 // its stores to the response body.
 func (m *MetricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	m.mtx.RLock()
 	defer m.mtx.RUnlock()
+
+	filter, err := parseScrapeFilter(r.URL.Query(), m.knownCollectors())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	resHeader := w.Header()
 	var writer io.Writer = w
 
-	resHeader.Set("Content-Type", `text/plain; version=`+"0.0.4")
-
-	if m.enableGZIPEncoding {
-		// Gzip response if requested. Taken from
-		// github.com/prometheus/client_golang/prometheus/promhttp.decorateWriter.
-		reqHeader := r.Header.Get("Accept-Encoding")
-		parts := strings.Split(reqHeader, ",")
-		for _, part := range parts {
-			part = strings.TrimSpace(part)
-			if part == "gzip" || strings.HasPrefix(part, "gzip;") {
-				writer = gzip.NewWriter(writer)
-				resHeader.Set("Content-Encoding", "gzip")
+	openMetrics := wantsOpenMetrics(r.Header.Get("Accept"))
+	if openMetrics {
+		resHeader.Set("Content-Type", contentTypeOpenMetrics)
+	} else {
+		resHeader.Set("Content-Type", contentTypeText)
+	}
+
+	var enc encoder
+	var pool *sync.Pool
+	if len(m.encodings) > 0 {
+		resHeader.Add("Vary", "Accept-Encoding")
+		if name := negotiateEncoding(r.Header.Get("Accept-Encoding"), m.encodings); name != "" {
+			pool = encoderPools[name]
+			enc = pool.Get().(encoder)
+			enc.Reset(w)
+			writer = enc
+			resHeader.Set("Content-Encoding", name)
+		}
+	}
+
+	var om *openMetricsWriter
+	if openMetrics {
+		om = newOpenMetricsWriter(writer, m.openMetricsFamilyFor)
+		writer = om
+	}
+
+	var nsFilter *lineWriter
+	if filter.filtersNamespaces() {
+		nsFilter = newLineWriter(writer, filter.filterLine)
+		writer = nsFilter
+	}
+
+	m.writeClusters(writer, filter)
+
+	if nsFilter != nil {
+		nsFilter.Flush()
+	}
+
+	if om != nil {
+		om.Close()
+	}
+
+	// In case we compressed the response, we have to close the encoder to
+	// flush it before handing it back to the pool.
+	if enc != nil {
+		enc.Close()
+		pool.Put(enc)
+	}
+}
+
+// openMetricsFamilyFor returns how the named family of any cluster is exposed
+// in the OpenMetrics format. m.mtx must be held.
+func (m *MetricsHandler) openMetricsFamilyFor(name string) (store.OpenMetricsFamily, bool) {
+	for _, c := range m.clusters {
+		if f, ok := c.Builder.OpenMetricsFamilyFor(name); ok {
+			return f, true
+		}
+	}
+	return store.OpenMetricsFamilyFor(name)
+}
+
+// writeClusters writes the stores of every cluster accepted by filter. With a
+// single unnamed cluster the stores are written as they are, otherwise the
+// cluster label is injected and the families of all clusters are merged.
+func (m *MetricsHandler) writeClusters(w io.Writer, filter scrapeFilter) {
+	if len(m.clusters) == 1 && m.clusters[0].Name == "" {
+		c := m.clusters[0]
+		for i, s := range c.stores {
+			if filter.includesCollector(c.storeNames[i]) {
+				s.WriteAll(w)
 			}
 		}
+		c.Builder.WriteRolloutMetrics(w, filter.includesCollector)
+		return
 	}
 
-	for _, s := range m.stores {
-		s.WriteAll(w)
+	for _, name := range m.collectorNames() {
+		if !filter.includesCollector(name) {
+			continue
+		}
+		expositions := [][]byte{}
+		for _, c := range m.clusters {
+			for i, s := range c.stores {
+				if c.storeNames[i] == name {
+					expositions = append(expositions, writeLabeled(c.Name, s.WriteAll))
+				}
+			}
+		}
+		writeMergedFamilies(w, expositions)
 	}
 
-	// In case we gzipped the response, we have to close the writer.
-	if closer, ok := writer.(io.Closer); ok {
-		closer.Close()
+	expositions := [][]byte{}
+	for _, c := range m.clusters {
+		builder := c.Builder
+		expositions = append(expositions, writeLabeled(c.Name, func(w io.Writer) {
+			builder.WriteRolloutMetrics(w, filter.includesCollector)
+		}))
 	}
+	writeMergedFamilies(w, expositions)
+}
+
+// collectorNames returns the names of the collectors active in any cluster,
+// sorted.
+func (m *MetricsHandler) collectorNames() []string {
+	seen := map[string]struct{}{}
+	names := []string{}
+	for _, c := range m.clusters {
+		for _, name := range c.storeNames {
+			if _, ok := seen[name]; !ok {
+				seen[name] = struct{}{}
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// knownCollectors returns the names scrapes can be filtered by, sorted: the
+// built-in collectors, whether they are active or not, and the collectors,
+// including custom resources, of the stores built in any cluster. m.mtx must
+// be held.
+func (m *MetricsHandler) knownCollectors() []string {
+	names := store.AvailableCollectors()
+	for _, name := range m.collectorNames() {
+		if !store.CollectorExists(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func shardingSettingsFromStatefulSet(ss *appsv1.StatefulSet, podName string) (nominal int32, totalReplicas int, err error) {
+	nominal, err = detectNominalFromPod(ss.Name, podName)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "detecting Pod nominal")
+	}
+
+	totalReplicas = 1
+	replicas := ss.Spec.Replicas
+	if replicas != nil {
+		totalReplicas = int(*replicas)
+	}
+
+	return nominal, totalReplicas, nil
+}
+
+func detectNominalFromPod(statefulSetName, podName string) (int32, error) {
+	nominalString := strings.TrimPrefix(podName, statefulSetName+"-")
+	nominal, err := strconv.Atoi(nominalString)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to detect shard index for Pod %s of StatefulSet %s, parsed %s", podName, statefulSetName, nominalString)
+	}
+
+	return int32(nominal), nil
+}
+
+func detectStatefulSet(kubeClient kubernetes.Interface, podName, namespaceName string) (*appsv1.StatefulSet, error) {
+	p, err := kubeClient.CoreV1().Pods(namespaceName).Get(podName, metav1.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "retrieve pod %s for sharding", podName)
+	}
+
+	owners := p.GetOwnerReferences()
+	for _, o := range owners {
+		if o.APIVersion != "apps/v1" || o.Kind != "StatefulSet" || o.Controller == nil || !*o.Controller {
+			continue
+		}
+
+		ss, err := kubeClient.AppsV1().StatefulSets(namespaceName).Get(o.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, errors.Wrapf(err, "retrieve shard's StatefulSet: %s/%s", namespaceName, o.Name)
+		}
+
+		return ss, nil
+	}
+
+	return nil, errors.Errorf("no suitable statefulset found for auto detecting sharding for Pod %s/%s", namespaceName, podName)
 }
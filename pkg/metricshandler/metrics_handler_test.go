@@ -0,0 +1,149 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metricshandler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/kube-state-metrics/pkg/metric"
+	metricsstore "k8s.io/kube-state-metrics/pkg/metrics_store"
+
+	"github.com/SchoIsles/kruise-state-metrics/internal/store"
+	"github.com/SchoIsles/kruise-state-metrics/pkg/options"
+)
+
+// newTestStore returns a store with a single gauge family holding one sample
+// per given object, each given as namespace/name.
+func newTestStore(t *testing.T, family string, objects ...string) *metricsstore.MetricsStore {
+	generators := []metric.FamilyGenerator{
+		{
+			Name: family,
+			Type: metric.Gauge,
+			Help: "Test family.",
+			GenerateFunc: func(obj interface{}) *metric.Family {
+				o := obj.(*metav1.ObjectMeta)
+				return &metric.Family{
+					Metrics: []*metric.Metric{
+						{
+							LabelKeys:   []string{"namespace", "name"},
+							LabelValues: []string{o.Namespace, o.Name},
+							Value:       1,
+						},
+					},
+				}
+			},
+		},
+	}
+
+	s := metricsstore.NewMetricsStore(metric.ExtractMetricFamilyHeaders(generators), metric.ComposeMetricGenFuncs(generators))
+	for _, o := range objects {
+		parts := strings.SplitN(o, "/", 2)
+		if err := s.Add(&metav1.ObjectMeta{UID: types.UID(o), Namespace: parts[0], Name: parts[1]}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s
+}
+
+// newTestHandler returns a handler exposing the given, already built,
+// clusters.
+func newTestHandler(encodings []string, clusters ...clusterStores) *MetricsHandler {
+	m := New(&options.Options{}, nil, nil, encodings)
+	for i := range clusters {
+		c := clusters[i]
+		if c.Builder == nil {
+			c.Builder = store.NewBuilder()
+		}
+		m.clusters = append(m.clusters, &c)
+	}
+	return m
+}
+
+func scrape(m *MetricsHandler, target string, header http.Header) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	for k, v := range header {
+		r.Header[k] = v
+	}
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, r)
+	return w
+}
+
+func TestServeHTTPCollectorFilter(t *testing.T) {
+	m := newTestHandler(nil, clusterStores{
+		stores: []*metricsstore.MetricsStore{
+			newTestStore(t, "kube_cloneset_created", "ns/a"),
+			newTestStore(t, "kube_imagepulljob_created", "ns/b"),
+		},
+		storeNames: []string{"clonesets", "imagepulljobs"},
+	})
+
+	tests := []struct {
+		target   string
+		wantCode int
+		want     []string
+		notWant  []string
+	}{
+		{
+			target:   "/metrics",
+			wantCode: http.StatusOK,
+			want:     []string{"kube_cloneset_created", "kube_imagepulljob_created"},
+		},
+		{
+			target:   "/metrics?collectors=imagepulljobs",
+			wantCode: http.StatusOK,
+			want:     []string{`kube_imagepulljob_created{namespace="ns",name="b"} 1`},
+			notWant:  []string{"kube_cloneset_created"},
+		},
+		{
+			// Built-in collectors that are not active select nothing.
+			target:   "/metrics?collectors=sidecarsets",
+			wantCode: http.StatusOK,
+			notWant:  []string{"kube_cloneset_created", "kube_imagepulljob_created"},
+		},
+		{
+			target:   "/metrics?collectors=clonesets,unknown",
+			wantCode: http.StatusBadRequest,
+			want:     []string{"collector unknown does not exist", "imagepulljobs"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			w := scrape(m, tt.target, nil)
+			if w.Code != tt.wantCode {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantCode, w.Code, w.Body.String())
+			}
+			body := w.Body.String()
+			for _, s := range tt.want {
+				if !strings.Contains(body, s) {
+					t.Errorf("expected response to contain %s, got:\n%s", s, body)
+				}
+			}
+			for _, s := range tt.notWant {
+				if strings.Contains(body, s) {
+					t.Errorf("expected response not to contain %s, got:\n%s", s, body)
+				}
+			}
+		})
+	}
+}
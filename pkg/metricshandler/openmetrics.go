@@ -0,0 +1,113 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metricshandler
+
+import (
+	"bytes"
+	"io"
+	"strings"
+
+	"github.com/SchoIsles/kruise-state-metrics/internal/store"
+)
+
+const (
+	contentTypeText        = `text/plain; version=0.0.4`
+	contentTypeOpenMetrics = `application/openmetrics-text; version=1.0.0; charset=utf-8`
+
+	mediaTypeText        = "text/plain"
+	mediaTypeOpenMetrics = "application/openmetrics-text"
+)
+
+// wantsOpenMetrics returns whether the given Accept header value prefers the
+// OpenMetrics format over the classic text format.
+func wantsOpenMetrics(accept string) bool {
+	openMetricsQ, textQ := 0.0, 0.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, q := parseQuality(part)
+		switch mediaType {
+		case mediaTypeOpenMetrics:
+			if q > openMetricsQ {
+				openMetricsQ = q
+			}
+		case mediaTypeText:
+			if q > textQ {
+				textQ = q
+			}
+		}
+	}
+	return openMetricsQ > 0 && openMetricsQ >= textQ
+}
+
+// openMetricsWriter rewrites the classic text format written by the metrics
+// stores into the OpenMetrics format. It has to be closed to terminate the
+// exposition with "# EOF".
+type openMetricsWriter struct {
+	*lineWriter
+	w io.Writer
+
+	family     string
+	familyType store.OpenMetricsFamily
+	familyFor  func(name string) (store.OpenMetricsFamily, bool)
+}
+
+// newOpenMetricsWriter returns an openMetricsWriter that looks up how each
+// family is exposed with familyFor.
+func newOpenMetricsWriter(w io.Writer, familyFor func(name string) (store.OpenMetricsFamily, bool)) *openMetricsWriter {
+	o := &openMetricsWriter{w: w, familyFor: familyFor}
+	o.lineWriter = newLineWriter(w, o.rewriteLine)
+	return o
+}
+
+// Close writes the OpenMetrics terminator. It does not close the underlying
+// writer.
+func (o *openMetricsWriter) Close() error {
+	if err := o.Flush(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(o.w, "# EOF\n")
+	return err
+}
+
+func (o *openMetricsWriter) rewriteLine(line []byte) []byte {
+	switch {
+	case bytes.HasPrefix(line, []byte("# TYPE ")):
+		fields := strings.Fields(string(line))
+		if len(fields) != 4 {
+			return line
+		}
+		o.family = fields[2]
+		familyType, ok := o.familyFor(o.family)
+		if !ok {
+			o.familyType = store.OpenMetricsFamily{}
+			return line
+		}
+		o.familyType = familyType
+		return []byte("# TYPE " + o.family + " " + familyType.Type + "\n")
+	case bytes.HasPrefix(line, []byte("#")):
+		return line
+	}
+
+	switch o.familyType.Type {
+	case store.OpenMetricsInfo:
+		if bytes.HasPrefix(line, []byte(o.family)) {
+			return append([]byte(o.family+"_info"), line[len(o.family):]...)
+		}
+	case store.OpenMetricsStateSet:
+		return renameLabel(line, o.familyType.StateLabel, o.family)
+	}
+	return line
+}
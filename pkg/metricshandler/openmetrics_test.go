@@ -0,0 +1,162 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metricshandler
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/SchoIsles/kruise-state-metrics/internal/store"
+)
+
+func TestWantsOpenMetrics(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   bool
+	}{
+		{accept: "", want: false},
+		{accept: "*/*", want: false},
+		{accept: "text/plain", want: false},
+		{accept: "application/openmetrics-text", want: true},
+		{accept: "application/openmetrics-text; version=1.0.0; charset=utf-8", want: true},
+		{accept: "application/openmetrics-text;version=1.0.0;q=0.5,text/plain;version=0.0.4;q=0.4", want: true},
+		{accept: "application/openmetrics-text;q=0.4,text/plain;q=0.5", want: false},
+		{accept: "application/openmetrics-text;q=0,*/*", want: false},
+		{accept: "Application/OpenMetrics-Text", want: true},
+		{accept: "application/openmetrics-text;q=invalid", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			if got := wantsOpenMetrics(tt.accept); got != tt.want {
+				t.Errorf("wantsOpenMetrics(%q) = %v, want %v", tt.accept, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpenMetricsWriter(t *testing.T) {
+	familyFor := func(name string) (store.OpenMetricsFamily, bool) {
+		if name == "kube_imagepulljob_status_phase" {
+			return store.OpenMetricsFamily{Type: store.OpenMetricsStateSet, StateLabel: "phase"}, true
+		}
+		return store.OpenMetricsFamilyFor(name)
+	}
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "empty",
+			in:   "",
+			want: "# EOF\n",
+		},
+		{
+			name: "gauge",
+			in: "# HELP kube_cloneset_status_replicas The number of replicas.\n" +
+				"# TYPE kube_cloneset_status_replicas gauge\n" +
+				"kube_cloneset_status_replicas{namespace=\"ns\",cloneset=\"a\"} 3\n",
+			want: "# HELP kube_cloneset_status_replicas The number of replicas.\n" +
+				"# TYPE kube_cloneset_status_replicas gauge\n" +
+				"kube_cloneset_status_replicas{namespace=\"ns\",cloneset=\"a\"} 3\n" +
+				"# EOF\n",
+		},
+		{
+			name: "state set",
+			in: "# TYPE kube_cloneset_status_condition gauge\n" +
+				"kube_cloneset_status_condition{namespace=\"ns\",cloneset=\"a,{b}\",condition=\"Ready\",status=\"true\"} 1\n" +
+				"kube_cloneset_status_condition{namespace=\"ns\",cloneset=\"status=\\\"true\\\"\",condition=\"Ready\",status=\"false\"} 0\n",
+			want: "# TYPE kube_cloneset_status_condition stateset\n" +
+				"kube_cloneset_status_condition{namespace=\"ns\",cloneset=\"a,{b}\",condition=\"Ready\",kube_cloneset_status_condition=\"true\"} 1\n" +
+				"kube_cloneset_status_condition{namespace=\"ns\",cloneset=\"status=\\\"true\\\"\",condition=\"Ready\",kube_cloneset_status_condition=\"false\"} 0\n" +
+				"# EOF\n",
+		},
+		{
+			name: "custom resource state set",
+			in: "# TYPE kube_imagepulljob_status_phase gauge\n" +
+				"kube_imagepulljob_status_phase{namespace=\"ns\",imagepulljob=\"a\",phase=\"Running\"} 1\n",
+			want: "# TYPE kube_imagepulljob_status_phase stateset\n" +
+				"kube_imagepulljob_status_phase{namespace=\"ns\",imagepulljob=\"a\",kube_imagepulljob_status_phase=\"Running\"} 1\n" +
+				"# EOF\n",
+		},
+		{
+			name: "info",
+			in: "# TYPE kube_cloneset_labels gauge\n" +
+				"kube_cloneset_labels{namespace=\"ns\",cloneset=\"a\",label_app=\"x\"} 1\n" +
+				"kube_cloneset_labels 1\n",
+			want: "# TYPE kube_cloneset_labels info\n" +
+				"kube_cloneset_labels_info{namespace=\"ns\",cloneset=\"a\",label_app=\"x\"} 1\n" +
+				"kube_cloneset_labels_info 1\n" +
+				"# EOF\n",
+		},
+		{
+			name: "created",
+			in: "# TYPE kube_cloneset_created gauge\n" +
+				"kube_cloneset_created{namespace=\"ns\",cloneset=\"a\"} 1.5e+09\n",
+			want: "# TYPE kube_cloneset_created unknown\n" +
+				"kube_cloneset_created{namespace=\"ns\",cloneset=\"a\"} 1.5e+09\n" +
+				"# EOF\n",
+		},
+		{
+			name: "type of the previous family does not leak",
+			in: "# TYPE kube_cloneset_labels gauge\n" +
+				"kube_cloneset_labels{cloneset=\"a\"} 1\n" +
+				"# TYPE kube_cloneset_status_replicas gauge\n" +
+				"kube_cloneset_status_replicas{cloneset=\"a\"} 3\n",
+			want: "# TYPE kube_cloneset_labels info\n" +
+				"kube_cloneset_labels_info{cloneset=\"a\"} 1\n" +
+				"# TYPE kube_cloneset_status_replicas gauge\n" +
+				"kube_cloneset_status_replicas{cloneset=\"a\"} 3\n" +
+				"# EOF\n",
+		},
+		{
+			name: "missing trailing newline",
+			in: "# TYPE kube_cloneset_status_replicas gauge\n" +
+				"kube_cloneset_status_replicas{cloneset=\"a\"} 3",
+			want: "# TYPE kube_cloneset_status_replicas gauge\n" +
+				"kube_cloneset_status_replicas{cloneset=\"a\"} 3\n" +
+				"# EOF\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := newOpenMetricsWriter(&buf, familyFor)
+			// Write in small chunks to split lines across writes.
+			in := []byte(tt.in)
+			for len(in) > 0 {
+				n := 7
+				if n > len(in) {
+					n = len(in)
+				}
+				if _, err := w.Write(in[:n]); err != nil {
+					t.Fatal(err)
+				}
+				in = in[n:]
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
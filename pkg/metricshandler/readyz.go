@@ -0,0 +1,119 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metricshandler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"k8s.io/klog"
+
+	"github.com/SchoIsles/kruise-state-metrics/internal/store"
+)
+
+// readiness is the JSON detail view of the readiness endpoint. In
+// multi-cluster mode the sync status is reported per cluster.
+type readiness struct {
+	Ready      bool                        `json:"ready"`
+	Collectors []store.CollectorSyncStatus `json:"collectors"`
+	Clusters   []clusterReadiness          `json:"clusters,omitempty"`
+}
+
+// clusterReadiness is the readiness of a single cluster in multi-cluster
+// mode.
+type clusterReadiness struct {
+	Name       string                      `json:"name"`
+	Ready      bool                        `json:"ready"`
+	Reachable  bool                        `json:"reachable"`
+	Error      string                      `json:"error,omitempty"`
+	Collectors []store.CollectorSyncStatus `json:"collectors"`
+}
+
+// readinessStatus reports whether the stores are configured and every one of
+// them has completed its initial List. In multi-cluster mode the handler is
+// ready as soon as one cluster is, so that an unreachable cluster does not
+// take the others down.
+func (m *MetricsHandler) readinessStatus() readiness {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+
+	// Sharding is not configured yet, so no store has been built.
+	if m.curTotalShards == 0 {
+		return readiness{Collectors: []store.CollectorSyncStatus{}}
+	}
+
+	if len(m.clusters) == 1 && m.clusters[0].Name == "" {
+		collectors := m.clusters[0].Builder.SyncStatus()
+		return readiness{Ready: allSynced(collectors), Collectors: collectors}
+	}
+
+	r := readiness{Collectors: []store.CollectorSyncStatus{}}
+	for _, c := range m.clusters {
+		collectors := c.Builder.SyncStatus()
+		cr := clusterReadiness{
+			Name:       c.Name,
+			Ready:      allSynced(collectors),
+			Reachable:  true,
+			Collectors: collectors,
+		}
+		if err := c.Builder.DiscoveryError(); err != nil {
+			cr.Reachable = false
+			cr.Error = err.Error()
+		}
+		if cr.Ready {
+			r.Ready = true
+		}
+		r.Clusters = append(r.Clusters, cr)
+	}
+	return r
+}
+
+func allSynced(collectors []store.CollectorSyncStatus) bool {
+	for _, c := range collectors {
+		if !c.Synced {
+			return false
+		}
+	}
+	return true
+}
+
+// ReadyzHandler returns a http.Handler that responds with 200 once every
+// enabled store (of at least one cluster in multi-cluster mode) has synced
+// and 503 otherwise. With ?format=json it responds with the per-cluster,
+// per-collector, per-namespace sync status.
+func (m *MetricsHandler) ReadyzHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := m.readinessStatus()
+
+		code := http.StatusOK
+		if !status.Ready {
+			code = http.StatusServiceUnavailable
+		}
+
+		if r.URL.Query().Get("format") == "json" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(code)
+			if err := json.NewEncoder(w).Encode(status); err != nil {
+				klog.Errorf("Failed to write readiness status: %v", err)
+			}
+			return
+		}
+
+		w.WriteHeader(code)
+		w.Write([]byte(http.StatusText(code)))
+	})
+}
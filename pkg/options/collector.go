@@ -0,0 +1,40 @@
+/*
+Copyright 2018 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package options
+
+import (
+	ksmoptions "k8s.io/kube-state-metrics/pkg/options"
+)
+
+var (
+	// DefaultCollectors represents the default set of collectors in
+	// kruise-state-metrics. Collectors that are available but not listed here
+	// are disabled unless explicitly requested via --collectors.
+	DefaultCollectors = ksmoptions.CollectorSet{
+		"broadcastjobs":     struct{}{},
+		"clonesets":         struct{}{},
+		"daemonsets":        struct{}{},
+		"sidecarsets":       struct{}{},
+		"statefulsets":      struct{}{},
+		"uniteddeployments": struct{}{},
+	}
+
+	// DefaultLabelsAllowList exports every Kubernetes label of every resource.
+	DefaultLabelsAllowList = LabelsAllowList{
+		LabelWildcard: {LabelWildcard},
+	}
+)
@@ -0,0 +1,122 @@
+/*
+Copyright 2018 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package options
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+	ksmoptions "k8s.io/kube-state-metrics/pkg/options"
+	"sigs.k8s.io/yaml"
+)
+
+// Config is the content of the file passed via --config. Every field that is
+// set overrides the corresponding flag.
+type Config struct {
+	Collectors                 []string         `json:"collectors,omitempty"`
+	CollectorsDenylist         []string         `json:"collectorsDenylist,omitempty"`
+	ForceCollectors            []string         `json:"forceCollectors,omitempty"`
+	Namespaces                 []string         `json:"namespaces,omitempty"`
+	MetricAllowlist            []string         `json:"metricAllowlist,omitempty"`
+	MetricDenylist             []string         `json:"metricDenylist,omitempty"`
+	MetricLabelsAllowlist      LabelsAllowList  `json:"metricLabelsAllowlist,omitempty"`
+	MetricAnnotationsAllowlist LabelsAllowList  `json:"metricAnnotationsAllowlist,omitempty"`
+	Shard                      *int32           `json:"shard,omitempty"`
+	TotalShards                *int             `json:"totalShards,omitempty"`
+	CustomResources            []CustomResource `json:"customResources,omitempty"`
+}
+
+// LoadConfig reads and parses the config file at path. It returns the
+// config along with the hex encoded SHA-256 hash of the file content.
+func LoadConfig(path string) (*Config, string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+	sum := sha256.Sum256(data)
+
+	c := &Config{}
+	if err := yaml.UnmarshalStrict(data, c); err != nil {
+		return nil, "", errors.Wrapf(err, "parsing %s", path)
+	}
+	if c.TotalShards != nil && *c.TotalShards < 1 {
+		return nil, "", errors.Errorf("totalShards must be at least 1, got %d", *c.TotalShards)
+	}
+	if c.Shard != nil && c.TotalShards != nil && int(*c.Shard) >= *c.TotalShards {
+		return nil, "", errors.Errorf("shard %d is out of range for %d total shards", *c.Shard, *c.TotalShards)
+	}
+	return c, hex.EncodeToString(sum[:]), nil
+}
+
+// Apply returns a copy of o with the fields set in the config overridden.
+func (c *Config) Apply(o *Options) *Options {
+	applied := *o
+
+	if c.Collectors != nil {
+		applied.Collectors = collectorSet(c.Collectors)
+	}
+	if c.CollectorsDenylist != nil {
+		applied.CollectorsDenylist = collectorSet(c.CollectorsDenylist)
+	}
+	if c.ForceCollectors != nil {
+		applied.ForceCollectors = collectorSet(c.ForceCollectors)
+	}
+	if c.Namespaces != nil {
+		applied.Namespaces = ksmoptions.NamespaceList(c.Namespaces)
+	}
+	if c.MetricAllowlist != nil {
+		applied.MetricWhitelist = metricSet(c.MetricAllowlist)
+	}
+	if c.MetricDenylist != nil {
+		applied.MetricBlacklist = metricSet(c.MetricDenylist)
+	}
+	if c.MetricLabelsAllowlist != nil {
+		applied.LabelsAllowList = c.MetricLabelsAllowlist
+	}
+	if c.MetricAnnotationsAllowlist != nil {
+		applied.AnnotationsAllowList = c.MetricAnnotationsAllowlist
+	}
+	if c.Shard != nil {
+		applied.Shard = *c.Shard
+	}
+	if c.TotalShards != nil {
+		applied.TotalShards = *c.TotalShards
+	}
+	if c.CustomResources != nil {
+		applied.CustomResources = c.CustomResources
+	}
+
+	return &applied
+}
+
+func collectorSet(l []string) ksmoptions.CollectorSet {
+	s := ksmoptions.CollectorSet{}
+	for _, c := range l {
+		s[c] = struct{}{}
+	}
+	return s
+}
+
+func metricSet(l []string) ksmoptions.MetricSet {
+	s := ksmoptions.MetricSet{}
+	for _, m := range l {
+		s[m] = struct{}{}
+	}
+	return s
+}
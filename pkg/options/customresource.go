@@ -0,0 +1,71 @@
+/*
+Copyright 2018 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package options
+
+// Types of the metrics of a custom resource.
+const (
+	CustomResourceGauge    = "gauge"
+	CustomResourceStateSet = "stateSet"
+	CustomResourceInfo     = "info"
+)
+
+// CustomResource configures a generic collector that exposes metrics of the
+// objects of any resource, read through the dynamic client.
+type CustomResource struct {
+	// Name is the collector name, used by scrape filtering and the label
+	// and annotation allow lists. Defaults to Resource.
+	Name     string `json:"name,omitempty"`
+	Group    string `json:"group"`
+	Version  string `json:"version"`
+	Resource string `json:"resource"`
+	Kind     string `json:"kind"`
+	// ClusterScoped is set for resources that are not namespaced.
+	ClusterScoped bool `json:"clusterScoped,omitempty"`
+	// MetricNamePrefix is prepended to every metric name. Defaults to
+	// kube_<lowercase kind>. It must be unique and must not be the prefix of
+	// a built-in metric, such as kube_cloneset.
+	MetricNamePrefix string                 `json:"metricNamePrefix,omitempty"`
+	Metrics          []CustomResourceMetric `json:"metrics"`
+}
+
+// CustomResourceMetric defines a metric family of a custom resource by field
+// paths. Paths are dot separated, e.g. status.updatedReplicas, and the empty
+// path is the object itself.
+//
+// Path selects the node the series are generated from. If it is a list, or a
+// map and LabelFromKey is set, one series is generated per item, otherwise a
+// single one from the node. ValuePath and LabelsFromPath are relative to each
+// item. The items of a list are told apart by LabelsFromPath, which must be set.
+type CustomResourceMetric struct {
+	Name string `json:"name"`
+	Help string `json:"help,omitempty"`
+	// Type is gauge, stateSet or info.
+	Type string `json:"type"`
+	Path string `json:"path,omitempty"`
+	// ValuePath selects the value of a gauge or the state of a state set.
+	// Numbers, booleans, numeric and boolean strings, quantities and RFC 3339
+	// timestamps are supported as gauge values.
+	ValuePath string `json:"valuePath,omitempty"`
+	// LabelsFromPath maps label names to the paths of their values.
+	LabelsFromPath map[string]string `json:"labelsFromPath,omitempty"`
+	// LabelFromKey is the name of the label holding the map key of an item.
+	LabelFromKey string `json:"labelFromKey,omitempty"`
+	// StateLabel is the label holding the state of a state set. Defaults to
+	// state.
+	StateLabel string   `json:"stateLabel,omitempty"`
+	States     []string `json:"states,omitempty"`
+}
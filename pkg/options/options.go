@@ -0,0 +1,144 @@
+/*
+Copyright 2018 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package options
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/pflag"
+	"k8s.io/klog"
+	ksmoptions "k8s.io/kube-state-metrics/pkg/options"
+)
+
+// Options are the configurable parameters for kruise-state-metrics.
+type Options struct {
+	Apiserver            string
+	Kubeconfig           string
+	KubeconfigContexts   []string
+	KubeconfigDir        string
+	Help                 bool
+	Port                 int
+	Host                 string
+	TelemetryPort        int
+	TelemetryHost        string
+	Collectors           ksmoptions.CollectorSet
+	CollectorsDenylist   ksmoptions.CollectorSet
+	ForceCollectors      ksmoptions.CollectorSet
+	DiscoveryInterval    time.Duration
+	DiscoveryTimeout     time.Duration
+	Namespaces           ksmoptions.NamespaceList
+	Shard                int32
+	TotalShards          int
+	Pod                  string
+	Namespace            string
+	MetricBlacklist      ksmoptions.MetricSet
+	MetricWhitelist      ksmoptions.MetricSet
+	LabelsAllowList      LabelsAllowList
+	AnnotationsAllowList LabelsAllowList
+	Version              bool
+
+	EnableGZIPEncoding   bool
+	CompressionEncodings []string
+
+	EventSink    string
+	EventLogFile string
+
+	ConfigFile           string
+	ConfigReloadInterval time.Duration
+	// CustomResources can only be set in the config file.
+	CustomResources []CustomResource
+
+	flags *pflag.FlagSet
+}
+
+// NewOptions returns a new instance of `Options`.
+func NewOptions() *Options {
+	return &Options{
+		Collectors:           ksmoptions.CollectorSet{},
+		CollectorsDenylist:   ksmoptions.CollectorSet{},
+		ForceCollectors:      ksmoptions.CollectorSet{},
+		MetricWhitelist:      ksmoptions.MetricSet{},
+		MetricBlacklist:      ksmoptions.MetricSet{},
+		LabelsAllowList:      LabelsAllowList{},
+		AnnotationsAllowList: LabelsAllowList{},
+	}
+}
+
+// AddFlags populated the Options struct from the command line arguments passed.
+func (o *Options) AddFlags() {
+	o.flags = pflag.NewFlagSet("", pflag.ExitOnError)
+	// add klog flags
+	klogFlags := flag.NewFlagSet("klog", flag.ExitOnError)
+	klog.InitFlags(klogFlags)
+	o.flags.AddGoFlagSet(klogFlags)
+	o.flags.Lookup("logtostderr").Value.Set("true")
+	o.flags.Lookup("logtostderr").DefValue = "true"
+	o.flags.Lookup("logtostderr").NoOptDefVal = "true"
+
+	o.flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage of %s:\n", os.Args[0])
+		o.flags.PrintDefaults()
+	}
+
+	o.flags.StringVar(&o.Apiserver, "apiserver", "", `The URL of the apiserver to use as a master`)
+	o.flags.StringVar(&o.Kubeconfig, "kubeconfig", "", "Absolute path to the kubeconfig file")
+	o.flags.StringSliceVar(&o.KubeconfigContexts, "kubeconfig-contexts", nil, "Comma-separated list of contexts of the kubeconfig file to watch one cluster each. Every metric gets a cluster label with the context name.")
+	o.flags.StringVar(&o.KubeconfigDir, "kubeconfig-dir", "", "Directory of kubeconfig files to watch one cluster each. Every metric gets a cluster label with the file name without extension.")
+	o.flags.BoolVarP(&o.Help, "help", "h", false, "Print Help text")
+	o.flags.IntVar(&o.Port, "port", 80, `Port to expose metrics on.`)
+	o.flags.StringVar(&o.Host, "host", "0.0.0.0", `Host to expose metrics on.`)
+	o.flags.IntVar(&o.TelemetryPort, "telemetry-port", 81, `Port to expose kruise-state-metrics self metrics on.`)
+	o.flags.StringVar(&o.TelemetryHost, "telemetry-host", "0.0.0.0", `Host to expose kruise-state-metrics self metrics on.`)
+	o.flags.Var(&o.Collectors, "collectors", fmt.Sprintf("Comma-separated list of collectors to be enabled. Defaults to %q", &DefaultCollectors))
+	o.flags.Var(&o.CollectorsDenylist, "collectors-denylist", "Comma-separated list of collectors to be disabled. It is applied after --collectors, so it can be used to drop collectors from the default set.")
+	o.flags.Var(&o.ForceCollectors, "force-collectors", "Comma-separated list of enabled collectors to build even if API discovery reports their apps.kruise.io resource as not served.")
+	o.flags.DurationVar(&o.DiscoveryInterval, "discovery-interval", 5*time.Minute, "Interval at which API discovery is re-run to enable or disable collectors as Kruise CRDs are installed or removed. Set to 0 to only run discovery at startup.")
+	o.flags.DurationVar(&o.DiscoveryTimeout, "discovery-timeout", 10*time.Second, "Timeout of the API discovery requests to a cluster. An unreachable cluster keeps its collectors until discovery succeeds again.")
+	o.flags.Var(&o.Namespaces, "namespace", fmt.Sprintf("Comma-separated list of namespaces to be enabled. Defaults to %q", &ksmoptions.DefaultNamespaces))
+	o.flags.Var(&o.MetricWhitelist, "metric-whitelist", "Comma-separated list of metrics to be exposed. This list comprises of exact metric names and/or regex patterns. The whitelist and blacklist are mutually exclusive.")
+	o.flags.Var(&o.MetricBlacklist, "metric-blacklist", "Comma-separated list of metrics not to be enabled. This list comprises of exact metric names and/or regex patterns. The whitelist and blacklist are mutually exclusive.")
+	o.flags.Var(&o.LabelsAllowList, "metric-labels-allowlist", fmt.Sprintf("Comma-separated list of Kubernetes label keys that will be used in the resource's labels metric, e.g. clonesets=[app,team],statefulsets=[*]. %q as resource applies to all resources, %q as key allows all labels. Defaults to %q.", LabelWildcard, LabelWildcard, &DefaultLabelsAllowList))
+	o.flags.Var(&o.AnnotationsAllowList, "metric-annotations-allowlist", "Comma-separated list of Kubernetes annotation keys that will be used in the resource's annotations metric, in the same format as --metric-labels-allowlist. By default no annotations are exported.")
+	o.flags.Int32Var(&o.Shard, "shard", int32(0), "The instances shard nominal (zero indexed) within the total number of shards. (default 0)")
+	o.flags.IntVar(&o.TotalShards, "total-shards", 1, "The total number of shards. Sharding is disabled when total shards is set to 1.")
+
+	autoshardingNotice := "When set, it is expected that --pod and --pod-namespace are both set. Most likely this should be passed via the downward API. This is used for auto-detecting sharding. If set, this has preference over statically configured sharding. This is experimental, it may be removed without notice."
+
+	o.flags.StringVar(&o.Pod, "pod", "", "Name of the pod that contains the kruise-state-metrics container. "+autoshardingNotice)
+	o.flags.StringVar(&o.Namespace, "pod-namespace", "", "Name of the namespace of the pod specified by --pod. "+autoshardingNotice)
+	o.flags.BoolVarP(&o.Version, "version", "", false, "kruise-state-metrics build version information")
+	o.flags.BoolVar(&o.EnableGZIPEncoding, "enable-gzip-encoding", false, "Gzip responses when requested by clients via 'Accept-Encoding: gzip' header.")
+	o.flags.StringVar(&o.EventSink, "event-sink", "", "Where to report transitions of watched workloads (new revision, paused/resumed, partition change, failing condition): 'file' writes JSON lines to --event-log-file, 'kubernetes' creates core/v1 Events. Disabled when empty.")
+	o.flags.StringVar(&o.EventLogFile, "event-log-file", "-", "File the 'file' event sink appends JSON lines to. '-' writes to stdout.")
+	o.flags.StringVar(&o.ConfigFile, "config", "", "Path to a YAML config file setting collectors, namespaces, metric allow/deny lists, label and annotation allow lists and sharding. Settings in the file override the corresponding flags.")
+	o.flags.DurationVar(&o.ConfigReloadInterval, "config-reload-interval", 30*time.Second, "Interval at which the --config file is checked for changes, which are applied by rebuilding the stores. Set to 0 to only read the file at startup.")
+	o.flags.StringSliceVar(&o.CompressionEncodings, "compression-encodings", nil, "Comma-separated list of encodings (gzip, zstd, snappy) used to compress responses, in order of preference, when accepted by clients via the 'Accept-Encoding' header. --enable-gzip-encoding appends gzip to this list.")
+}
+
+// Parse parses the flag definitions from the argument list.
+func (o *Options) Parse() error {
+	err := o.flags.Parse(os.Args)
+	return err
+}
+
+// Usage is the function called when an error occurs while parsing flags.
+func (o *Options) Usage() {
+	o.flags.Usage()
+}
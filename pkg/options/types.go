@@ -0,0 +1,92 @@
+/*
+Copyright 2018 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package options
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// LabelWildcard allows every Kubernetes label or annotation, or, used as the
+// resource, applies an allow list to every resource.
+const LabelWildcard = "*"
+
+// LabelsAllowList represents a per-resource list of Kubernetes labels or
+// annotations that are converted to Prometheus labels, e.g.
+// "clonesets=[app,team],statefulsets=[*]".
+type LabelsAllowList map[string][]string
+
+func (l *LabelsAllowList) String() string {
+	s := *l
+
+	resources := make([]string, 0, len(s))
+	for r := range s {
+		resources = append(resources, r)
+	}
+	sort.Strings(resources)
+
+	ss := make([]string, 0, len(s))
+	for _, r := range resources {
+		ss = append(ss, r+"=["+strings.Join(s[r], ",")+"]")
+	}
+	return strings.Join(ss, ",")
+}
+
+// Set parses a string of the form "resource=[key1,key2],resource2=[key3]"
+// and adds it to the LabelsAllowList.
+func (l *LabelsAllowList) Set(value string) error {
+	s := *l
+
+	value = strings.TrimSpace(value)
+	for len(value) > 0 {
+		eq := strings.Index(value, "=[")
+		if eq <= 0 {
+			return errors.Errorf("invalid labels allow list %q, expected resource=[key,...]", value)
+		}
+		end := strings.Index(value[eq:], "]")
+		if end < 0 {
+			return errors.Errorf("invalid labels allow list %q, missing closing bracket", value)
+		}
+		end += eq
+
+		resource := strings.TrimSpace(value[:eq])
+		keys := []string{}
+		for _, k := range strings.Split(value[eq+2:end], ",") {
+			k = strings.TrimSpace(k)
+			if k != "" {
+				keys = append(keys, k)
+			}
+		}
+		s[resource] = append(s[resource], keys...)
+
+		value = strings.TrimSpace(value[end+1:])
+		if len(value) > 0 {
+			if value[0] != ',' {
+				return errors.Errorf("invalid labels allow list %q, expected a comma between resources", value)
+			}
+			value = strings.TrimSpace(value[1:])
+		}
+	}
+	return nil
+}
+
+// Type returns a descriptive string about the LabelsAllowList type.
+func (l *LabelsAllowList) Type() string {
+	return "string"
+}